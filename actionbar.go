@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
-	"syscall"
 	"time"
 )
 
@@ -18,6 +17,7 @@ import (
 //   SessionEnd ────────► removed
 //
 // The "needs approval" state is exclusively managed by handlePermissionRequest
+// and, for generic "permission_request" events, handleGenericPermission
 // (via updateActionBarPermission/clearActionBarPermission). Other hooks skip
 // action bar writes for permission events to avoid dual-write races.
 //
@@ -42,76 +42,76 @@ type ActionBarState struct {
 }
 
 func actionBarPath(peonDir string) string {
-	return filepath.Join(peonDir, ".actionbar.json")
+	return filepath.Join(stateDir(peonDir), ".actionbar.json")
 }
 
-// modifyActionBar performs an atomic read-modify-write of the action bar state
-// file under an exclusive flock to prevent lost updates from concurrent sessions.
+// modifyActionBar updates the action bar sessions in a store transaction;
+// the commit re-exports .actionbar.json for the helper. Errors are recorded
+// in the debug log; callers don't act on them.
 func modifyActionBar(peonDir string, fn func(abs *ActionBarState)) {
-	lockPath := filepath.Join(peonDir, ".actionbar.lock")
-	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
-		return
-	}
-	defer func() {
-		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
-		f.Close()
-	}()
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+	logError("modifyActionBar", openStore(peonDir).Update(func(d *StoreData) error {
+		fn(&d.ActionBar)
+		return nil
+	}))
+}
+
+// writeActionBarSession updates a single session in the action bar state file.
+func writeActionBarSession(peonDir, sessionID, project, state, message string, hwnd uint64) {
+	if sessionID == "" {
 		return
 	}
+	modifyActionBar(peonDir, func(abs *ActionBarState) {
+		abs.setSession(sessionID, project, state, message, hwnd)
+	})
+}
 
-	abPath := actionBarPath(peonDir)
-	var abs ActionBarState
-	if data, err := os.ReadFile(abPath); err == nil {
-		json.Unmarshal(data, &abs)
+// setSession records a session's state, pruning sessions not updated in the
+// last 10 minutes (a safety net for missed SessionEnd events).
+func (abs *ActionBarState) setSession(sessionID, project, state, message string, hwnd uint64) {
+	now := time.Now().Unix()
+	for id, s := range abs.Sessions {
+		if now-s.UpdatedAt > 600 {
+			delete(abs.Sessions, id)
+		}
 	}
-	if abs.Sessions == nil {
-		abs.Sessions = make(map[string]ActionBarSession)
+	abs.Sessions[sessionID] = ActionBarSession{
+		Project:   project,
+		State:     state,
+		Message:   message,
+		HWND:      hwnd,
+		UpdatedAt: now,
 	}
+}
 
-	fn(&abs)
-
-	data, err := json.Marshal(abs)
-	if err != nil {
+// removeActionBarSession removes a session from the action bar state file.
+func removeActionBarSession(peonDir, sessionID string) {
+	if sessionID == "" {
 		return
 	}
-	atomicWriteFile(abPath, data)
+	modifyActionBar(peonDir, func(abs *ActionBarState) {
+		delete(abs.Sessions, sessionID)
+	})
 }
 
-// writeActionBarSession updates a single session in the action bar state file.
-func writeActionBarSession(peonDir, sessionID, project, state, message string, hwnd uint64) {
+// ensureActionBarSession adds a "working" entry for a session the action bar
+// has not seen yet, so a permission request has a slot to attach to.
+func ensureActionBarSession(peonDir, sessionID, project string, hwnd uint64) {
 	if sessionID == "" {
 		return
 	}
 	modifyActionBar(peonDir, func(abs *ActionBarState) {
-		// Prune sessions older than 10 minutes (safety net).
-		now := time.Now().Unix()
-		for id, s := range abs.Sessions {
-			if now-s.UpdatedAt > 600 {
-				delete(abs.Sessions, id)
-			}
+		if _, ok := abs.Sessions[sessionID]; ok {
+			return
 		}
 		abs.Sessions[sessionID] = ActionBarSession{
 			Project:   project,
-			State:     state,
-			Message:   message,
+			State:     "working",
 			HWND:      hwnd,
-			UpdatedAt: now,
+			UpdatedAt: time.Now().Unix(),
 		}
 	})
 }
 
-// removeActionBarSession removes a session from the action bar state file.
-func removeActionBarSession(peonDir, sessionID string) {
-	if sessionID == "" {
-		return
-	}
-	modifyActionBar(peonDir, func(abs *ActionBarState) {
-		delete(abs.Sessions, sessionID)
-	})
-}
-
 // updateActionBarPermission sets a session to "needs approval" with tool details.
 // This is the single source of truth — the helper reads tool info from here.
 func updateActionBarPermission(peonDir, sessionID, toolName string, toolInput, permSuggestions json.RawMessage) {
@@ -154,10 +154,10 @@ func clearActionBarPermission(peonDir, sessionID string) {
 
 // atomicWriteFile writes data to a temp file then renames it into place,
 // preventing readers from seeing partial/corrupt content.
-func atomicWriteFile(path string, data []byte) {
+func atomicWriteFile(path string, data []byte) error {
 	tmp := path + ".tmp"
 	if err := os.WriteFile(tmp, data, 0644); err != nil {
-		return
+		return err
 	}
-	os.Rename(tmp, path)
+	return os.Rename(tmp, path)
 }
@@ -1,19 +1,42 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Adapter parses harness-specific JSON into an internal Event.
 type Adapter interface {
 	Parse(raw json.RawMessage) (Event, error)
 }
 
+// genericSchemaVersion is the newest generic payload version this binary
+// understands. Payloads without a "version" field are treated as version 1.
+//
+//	1: type, cwd, session_id, agent_mode, message
+//	2: + title, project, tool_name, tool_input, category, sound, notify,
+//	     urgency, duration_ms
+const genericSchemaVersion = 2
+
 // genericPayload is the fallback format any harness can send directly.
 type genericPayload struct {
+	Version   int    `json:"version"`
 	Type      string `json:"type"`
 	CWD       string `json:"cwd"`
 	SessionID string `json:"session_id"`
 	AgentMode bool   `json:"agent_mode"`
 	Message   string `json:"message"`
+
+	// Version 2 fields (all optional).
+	Title      string          `json:"title"`
+	Project    string          `json:"project"`
+	ToolName   string          `json:"tool_name"`
+	ToolInput  json.RawMessage `json:"tool_input"`
+	Category   string          `json:"category"`
+	Sound      string          `json:"sound"`
+	Notify     *bool           `json:"notify"`
+	Urgency    string          `json:"urgency"`
+	DurationMS int64           `json:"duration_ms"`
 }
 
 // GenericAdapter handles the internal event format sent directly.
@@ -24,13 +47,27 @@ func (GenericAdapter) Parse(raw json.RawMessage) (Event, error) {
 	if err := json.Unmarshal(raw, &p); err != nil {
 		return Event{}, err
 	}
-	return Event{
+	e := Event{
 		Type:      p.Type,
 		CWD:       p.CWD,
 		SessionID: p.SessionID,
 		AgentMode: p.AgentMode,
 		Message:   p.Message,
-	}, nil
+	}
+	// Version 1 bridges never sent the extended fields; only honor them when
+	// the sender declares it speaks version 2 or newer.
+	if p.Version >= 2 {
+		e.Title = p.Title
+		e.Project = p.Project
+		e.ToolName = p.ToolName
+		e.ToolInput = p.ToolInput
+		e.Category = p.Category
+		e.Sound = p.Sound
+		e.Notify = p.Notify
+		e.Urgency = p.Urgency
+		e.Duration = time.Duration(p.DurationMS) * time.Millisecond
+	}
+	return e, nil
 }
 
 // probeFields peeks at JSON to detect which harness sent it.
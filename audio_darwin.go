@@ -13,16 +13,17 @@ func captureWindowHandle() uint64 { return 0 }
 // playSound plays a WAV file via afplay (macOS).
 // Fire-and-forget.
 func playSound(file string, volume float64) {
-	cmd := exec.Command("afplay", "-v", fmt.Sprintf("%g", volume), file)
-	cmd.Start()
+	args := []string{"-v", fmt.Sprintf("%g", volume), file}
+	logCommand("afplay", args...)
+	logError("afplay", exec.Command("afplay", args...).Start())
 }
 
 // sendNotification shows a macOS notification via osascript.
 // Fire-and-forget. hwnd is ignored on macOS.
 func sendNotification(title, msg, icon string, hwnd uint64) {
 	script := fmt.Sprintf(`display notification %q with title %q`, msg, title)
-	cmd := exec.Command("osascript", "-e", script)
-	cmd.Start()
+	logCommand("osascript", "-e", script)
+	logError("osascript", exec.Command("osascript", "-e", script).Start())
 }
 
 // playSoundAndNotify plays sound and sends notification separately on macOS
@@ -44,14 +45,19 @@ func toWindowsPath(p string) string { return p }
 // detach is a no-op on macOS.
 func detach(args ...string) {}
 
+// startupVBSPath is empty on macOS (no Windows Startup folder).
+func startupVBSPath() string { return "" }
+
 // installStartupShortcut is a no-op on macOS (action bar is Windows-only).
-func installStartupShortcut(peonDir string) {
+func installStartupShortcut(peonDir string) error {
 	fmt.Println("peon-ping: startup install not supported on macOS")
+	return nil
 }
 
 // uninstallStartupShortcut is a no-op on macOS.
-func uninstallStartupShortcut() {
+func uninstallStartupShortcut() error {
 	fmt.Println("peon-ping: startup install not supported on macOS")
+	return nil
 }
 
 // relaunchFromSource is a no-op on macOS.
@@ -5,6 +5,7 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -18,11 +19,14 @@ import (
 func detach(args ...string) {
 	helper := findHelper()
 	if helper == "" {
+		logError("detach", fmt.Errorf("peon-helper.exe not found"))
 		return
 	}
+	logCommand(helper, args...)
 
 	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
 	if err != nil {
+		logError("detach", err)
 		return
 	}
 	defer devNull.Close()
@@ -32,7 +36,7 @@ func detach(args ...string) {
 	cmd.Stdin = devNull
 	cmd.Stdout = devNull
 	cmd.Stderr = devNull
-	cmd.Start()
+	logError("detach", cmd.Start())
 }
 
 // captureWindowHandle calls the helper synchronously to get the foreground HWND.
@@ -109,7 +113,8 @@ var cachedHelperPath string
 
 // findHelper locates peon-helper.exe next to the running binary.
 // To work around WSL/Windows executable image caching, the helper is copied
-// to /tmp with a content-hash filename so each new build gets a fresh image.
+// to the runtime dir (or /tmp) with a content-hash filename so each new build
+// gets a fresh image.
 func findHelper() string {
 	if cachedHelperPath != "" {
 		return cachedHelperPath
@@ -128,7 +133,7 @@ func findHelper() string {
 	// Short content hash for unique filename
 	hash := sha256.Sum256(data)
 	tag := hex.EncodeToString(hash[:4]) // 8 hex chars
-	dst := filepath.Join(os.TempDir(), "peon-helper-"+tag+".exe")
+	dst := filepath.Join(helperCacheDir(), "peon-helper-"+tag+".exe")
 
 	if _, err := os.Stat(dst); err != nil {
 		os.WriteFile(dst, data, 0755)
@@ -152,7 +157,7 @@ func relaunchFromSource(peonDir string) {
 	fmt.Printf("peon-ping: building from %s ...\n", srcDir)
 
 	// Build Linux binary.
-	cmd := exec.Command(goPath, "build", "-o", filepath.Join(peonDir, "peon"), ".")
+	cmd := exec.Command(goPath, "build", "-o", filepath.Join(binDir(peonDir), "peon"), ".")
 	cmd.Dir = srcDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -162,7 +167,7 @@ func relaunchFromSource(peonDir string) {
 	}
 
 	// Build Windows helper.
-	cmd = exec.Command(goPath, "build", "-ldflags", "-H windowsgui", "-o", filepath.Join(peonDir, "peon-helper.exe"), "./helper/")
+	cmd = exec.Command(goPath, "build", "-ldflags", "-H windowsgui", "-o", filepath.Join(binDir(peonDir), "peon-helper.exe"), "./helper/")
 	cmd.Dir = srcDir
 	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64")
 	cmd.Stdout = os.Stdout
@@ -172,7 +177,7 @@ func relaunchFromSource(peonDir string) {
 		os.Exit(1)
 	}
 
-	fmt.Println("peon-ping: installed to", peonDir)
+	fmt.Println("peon-ping: installed to", binDir(peonDir))
 
 	// Restart action bar (the new helper kills the old one).
 	cachedHelperPath = "" // clear cached path so findHelper picks up new binary
@@ -185,6 +190,7 @@ func relaunchFromSource(peonDir string) {
 func toWindowsPath(linuxPath string) string {
 	out, err := exec.Command("wslpath", "-w", linuxPath).Output()
 	if err != nil {
+		logError("wslpath", err)
 		return linuxPath
 	}
 	return strings.TrimSpace(string(out))
@@ -209,8 +215,8 @@ func startupVBSPath() string {
 
 // installStartupShortcut creates a VBS script in the Windows Startup folder
 // that silently launches the action bar on login.
-func installStartupShortcut(peonDir string) {
-	helperWin := toWindowsPath(filepath.Join(peonDir, "peon-helper.exe"))
+func installStartupShortcut(peonDir string) error {
+	helperWin := toWindowsPath(filepath.Join(binDir(peonDir), "peon-helper.exe"))
 	stateWin := toWindowsPath(actionBarPath(peonDir))
 
 	vbs := fmt.Sprintf(`Set WshShell = CreateObject("WScript.Shell")
@@ -219,32 +225,29 @@ WshShell.Run """%s"" actionbar ""%s""", 0, False
 
 	dest := startupVBSPath()
 	if dest == "" {
-		fmt.Fprintln(os.Stderr, "peon-ping: could not find Windows Startup folder")
-		os.Exit(1)
+		return errors.New("could not find Windows Startup folder")
 	}
 
 	if err := os.WriteFile(dest, []byte(vbs), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "peon-ping: failed to write startup script: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to write startup script: %w", err)
 	}
 	fmt.Printf("peon-ping: installed startup script at %s\n", toWindowsPath(dest))
+	return nil
 }
 
 // uninstallStartupShortcut removes the VBS startup script.
-func uninstallStartupShortcut() {
+func uninstallStartupShortcut() error {
 	dest := startupVBSPath()
 	if dest == "" {
-		fmt.Fprintln(os.Stderr, "peon-ping: could not find Windows Startup folder")
-		os.Exit(1)
+		return errors.New("could not find Windows Startup folder")
 	}
 	if err := os.Remove(dest); err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("peon-ping: no startup script found")
-		} else {
-			fmt.Fprintf(os.Stderr, "peon-ping: failed to remove: %v\n", err)
-			os.Exit(1)
+			return nil
 		}
-		return
+		return fmt.Errorf("failed to remove startup script: %w", err)
 	}
 	fmt.Println("peon-ping: startup script removed")
+	return nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// fileCache memoizes decoded files keyed by path and invalidates entries when
+// the file's mtime or size changes. One-shot hook invocations barely notice
+// it; --stream relies on it to avoid re-reading config and manifests for
+// every event.
+var fileCache = struct {
+	sync.Mutex
+	entries map[string]cachedFile
+}{entries: make(map[string]cachedFile)}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	value   any
+}
+
+// cachedLoad returns the decoded contents of path, calling decode only when
+// the file is new to the cache or has changed on disk since the last call.
+func cachedLoad[T any](path string, decode func([]byte) (T, error)) (T, error) {
+	var zero T
+	info, err := os.Stat(path)
+	if err != nil {
+		return zero, err
+	}
+
+	fileCache.Lock()
+	c, ok := fileCache.entries[path]
+	fileCache.Unlock()
+	if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		if v, ok := c.value.(T); ok {
+			return v, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return zero, err
+	}
+	v, err := decode(data)
+	if err != nil {
+		return zero, err
+	}
+
+	fileCache.Lock()
+	fileCache.entries[path] = cachedFile{modTime: info.ModTime(), size: info.Size(), value: v}
+	fileCache.Unlock()
+	return v, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// claudeHookEvents are the Claude Code hook events peon handles, with the
+// hook timeout (seconds) each one needs. PermissionRequest blocks while the
+// action bar waits for an answer (up to 5 minutes), so it gets a longer one.
+var claudeHookEvents = []struct {
+	Name    string
+	Timeout int
+}{
+	{"SessionStart", 10},
+	{"UserPromptSubmit", 10},
+	{"Stop", 10},
+	{"Notification", 10},
+	{"PermissionRequest", 330},
+	{"SessionEnd", 10},
+}
+
+// claudeSettingsPath returns the settings file for a Claude Code scope:
+// "user" (~/.claude/settings.json), "project" (./.claude/settings.json) or
+// "local" (./.claude/settings.local.json, not checked in).
+func claudeSettingsPath(scope string) (string, error) {
+	switch scope {
+	case "", "user":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".claude", "settings.json"), nil
+	case "project":
+		return filepath.Join(".claude", "settings.json"), nil
+	case "local":
+		return filepath.Join(".claude", "settings.local.json"), nil
+	default:
+		return "", fmt.Errorf("unknown scope %q (want user, project or local)", scope)
+	}
+}
+
+// peonHookCommand returns the command Claude Code should run: the binary in
+// the install dir if it is there, otherwise the running executable.
+func peonHookCommand(peonDir string) string {
+	installed := filepath.Join(binDir(peonDir), "peon")
+	if fileExists(installed) {
+		return installed
+	}
+	if exe, err := os.Executable(); err == nil {
+		return exe
+	}
+	return installed
+}
+
+// claudeHookCommand is peonHookCommand quoted for settings.json. Claude Code
+// runs hook commands through a shell, and install dirs can contain spaces
+// (~/Library/Application Support, Windows user names).
+func claudeHookCommand(peonDir string) string {
+	return shellQuote(peonHookCommand(peonDir))
+}
+
+// isPeonHookCommand reports whether a hook command runs peon: an installed
+// peon binary, or the running executable that peonHookCommand falls back to
+// (which may be named something else, like a go build output). The program
+// may be quoted, as claudeHookCommand writes it.
+func isPeonHookCommand(cmd string) bool {
+	prog := shellFirstWord(cmd)
+	if prog == "" {
+		return false
+	}
+	if filepath.Base(prog) == "peon" {
+		return true
+	}
+	exe, err := os.Executable()
+	return err == nil && prog == exe
+}
+
+// claudeSettings is settings.json decoded just enough to edit hooks while
+// round-tripping every other key untouched.
+type claudeSettings struct {
+	raw   map[string]json.RawMessage
+	hooks map[string][]map[string]any
+}
+
+func readClaudeSettings(path string) (*claudeSettings, error) {
+	s := &claudeSettings{
+		raw:   make(map[string]json.RawMessage),
+		hooks: make(map[string][]map[string]any),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s.raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if h, ok := s.raw["hooks"]; ok {
+		if err := json.Unmarshal(h, &s.hooks); err != nil {
+			return nil, fmt.Errorf("%s: hooks: %v", path, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *claudeSettings) marshal() ([]byte, error) {
+	if len(s.hooks) == 0 {
+		delete(s.raw, "hooks")
+	} else {
+		h, err := json.Marshal(s.hooks)
+		if err != nil {
+			return nil, err
+		}
+		s.raw["hooks"] = h
+	}
+	data, err := json.MarshalIndent(s.raw, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// removePeonHooks strips peon's hook commands from one event, dropping
+// matcher groups that end up empty. Other hooks are left untouched.
+func (s *claudeSettings) removePeonHooks(event string) {
+	var groups []map[string]any
+	for _, g := range s.hooks[event] {
+		list, _ := g["hooks"].([]any)
+		var kept []any
+		for _, h := range list {
+			if hm, ok := h.(map[string]any); ok {
+				if cmd, _ := hm["command"].(string); isPeonHookCommand(cmd) {
+					continue
+				}
+			}
+			kept = append(kept, h)
+		}
+		if len(list) > 0 && len(kept) == 0 {
+			continue
+		}
+		if len(list) > 0 {
+			g["hooks"] = kept
+		}
+		groups = append(groups, g)
+	}
+	if len(groups) == 0 {
+		delete(s.hooks, event)
+	} else {
+		s.hooks[event] = groups
+	}
+}
+
+// peonHooks returns peon's hook entries registered for an event.
+func (s *claudeSettings) peonHooks(event string) []map[string]any {
+	var found []map[string]any
+	for _, g := range s.hooks[event] {
+		list, _ := g["hooks"].([]any)
+		for _, h := range list {
+			if hm, ok := h.(map[string]any); ok {
+				if cmd, _ := hm["command"].(string); isPeonHookCommand(cmd) {
+					found = append(found, hm)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// claudeHookDrift describes how an event's registration differs from what
+// --install-claude would write. Empty means up to date.
+func (s *claudeSettings) claudeHookDrift(event string, timeout int, command string) string {
+	hooks := s.peonHooks(event)
+	switch {
+	case len(hooks) == 0:
+		return "missing"
+	case len(hooks) > 1:
+		return fmt.Sprintf("registered %d times", len(hooks))
+	}
+	if cmd, _ := hooks[0]["command"].(string); cmd != command {
+		return fmt.Sprintf("command is %q, want %q", cmd, command)
+	}
+	if t, _ := hooks[0]["timeout"].(float64); int(t) < timeout {
+		return fmt.Sprintf("timeout is %ds, want %ds", int(t), timeout)
+	}
+	return ""
+}
+
+// writeClaudeSettings backs up the existing file and writes the new one.
+func writeClaudeSettings(path string, s *claudeSettings) error {
+	data, err := s.marshal()
+	if err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(path); err == nil {
+		if bytes.Equal(old, data) {
+			return nil
+		}
+		if err := os.WriteFile(path+".peon-backup", old, 0644); err != nil {
+			return fmt.Errorf("backup: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return atomicWriteFile(path, data)
+}
+
+// installClaudeHooks merges peon's hook entries into a Claude Code settings
+// file. Safe to run repeatedly: existing peon entries are replaced, not
+// duplicated, and hooks from other tools are preserved.
+func installClaudeHooks(peonDir, scope string) error {
+	path, err := claudeSettingsPath(scope)
+	if err != nil {
+		return err
+	}
+	s, err := readClaudeSettings(path)
+	if err != nil {
+		return fmt.Errorf("could not read settings: %w", err)
+	}
+
+	command := claudeHookCommand(peonDir)
+	changed := 0
+	for _, ev := range claudeHookEvents {
+		if s.claudeHookDrift(ev.Name, ev.Timeout, command) == "" {
+			continue
+		}
+		s.removePeonHooks(ev.Name)
+		s.hooks[ev.Name] = append(s.hooks[ev.Name], map[string]any{
+			"matcher": "",
+			"hooks": []any{map[string]any{
+				"type":    "command",
+				"command": command,
+				"timeout": ev.Timeout,
+			}},
+		})
+		changed++
+	}
+	if changed == 0 {
+		fmt.Printf("peon-ping: Claude Code hooks already up to date in %s\n", path)
+		return nil
+	}
+	if err := writeClaudeSettings(path, s); err != nil {
+		return fmt.Errorf("could not write settings: %w", err)
+	}
+	fmt.Printf("peon-ping: installed %d Claude Code hook(s) in %s\n", changed, path)
+	return nil
+}
+
+// uninstallClaudeHooks removes peon's hook entries from a settings file.
+func uninstallClaudeHooks(scope string) error {
+	path, err := claudeSettingsPath(scope)
+	if err != nil {
+		return err
+	}
+	s, err := readClaudeSettings(path)
+	if err != nil {
+		return fmt.Errorf("could not read settings: %w", err)
+	}
+	removed := 0
+	for event := range s.hooks {
+		n := len(s.peonHooks(event))
+		if n > 0 {
+			s.removePeonHooks(event)
+			removed += n
+		}
+	}
+	if removed == 0 {
+		fmt.Printf("peon-ping: no Claude Code hooks found in %s\n", path)
+		return nil
+	}
+	if err := writeClaudeSettings(path, s); err != nil {
+		return fmt.Errorf("could not write settings: %w", err)
+	}
+	fmt.Printf("peon-ping: removed %d Claude Code hook(s) from %s\n", removed, path)
+	return nil
+}
+
+// checkClaudeHooks reports drift between a settings file and what
+// --install-claude would write. Returns false if anything differs.
+func checkClaudeHooks(peonDir, scope string) bool {
+	path, err := claudeSettingsPath(scope)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+		return false
+	}
+	s, err := readClaudeSettings(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not read settings: %v\n", err)
+		return false
+	}
+	command := claudeHookCommand(peonDir)
+	ok := true
+	fmt.Printf("peon-ping: checking %s\n", path)
+	for _, ev := range claudeHookEvents {
+		if drift := s.claudeHookDrift(ev.Name, ev.Timeout, command); drift != "" {
+			fmt.Printf("  %-18s %s\n", ev.Name, drift)
+			ok = false
+		} else {
+			fmt.Printf("  %-18s ok\n", ev.Name)
+		}
+	}
+	if !ok {
+		fmt.Printf("Run 'peon --install-claude --scope %s' to fix.\n", scopeOrUser(scope))
+	}
+	return ok
+}
+
+func scopeOrUser(scope string) string {
+	if scope == "" {
+		return "user"
+	}
+	return scope
+}
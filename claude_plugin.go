@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// claudePluginCommands are the slash commands shipped in the exported plugin.
+// Each runs the peon CLI through Claude Code's "!" bash prefix.
+var claudePluginCommands = []struct {
+	Name        string
+	Description string
+	Args        string // peon CLI arguments; {peon} stands for the binary again
+	Hint        string // argument-hint frontmatter, if the command takes arguments
+}{
+	{"peon-ping-toggle", "Toggle peon-ping sounds on/off", "--toggle", ""},
+	{"peon-ping-pause", "Mute peon-ping sounds", "--pause", ""},
+	{"peon-ping-resume", "Unmute peon-ping sounds", "--resume", ""},
+	{"peon-ping-status", "Show whether peon-ping is paused and list sound packs", "--status && {peon} --packs", ""},
+	{"peon-ping-pack", "Switch peon-ping sound pack (no argument cycles to the next)", "--pack $ARGUMENTS", "[pack-name]"},
+}
+
+// exportClaudePlugin writes a Claude Code plugin directory that registers
+// peon's hooks and slash commands, pointing at the installed binary.
+// The directory doubles as a single-plugin marketplace, so teammates can run
+// `/plugin marketplace add <dir>` and `/plugin install peon-ping@peon-ping`.
+func exportClaudePlugin(peonDir, dir string) {
+	command := claudeHookCommand(peonDir)
+
+	hooks := make(map[string][]map[string]any)
+	for _, ev := range claudeHookEvents {
+		hooks[ev.Name] = []map[string]any{{
+			"matcher": "",
+			"hooks": []any{map[string]any{
+				"type":    "command",
+				"command": command,
+				"timeout": ev.Timeout,
+			}},
+		}}
+	}
+
+	files := map[string]any{
+		filepath.Join(".claude-plugin", "plugin.json"): map[string]any{
+			"name":        "peon-ping",
+			"version":     version,
+			"description": "Warcraft III Peon voice lines and notifications for Claude Code hooks",
+			"homepage":    "https://github.com/" + updateRepo,
+			"license":     "MIT",
+		},
+		filepath.Join(".claude-plugin", "marketplace.json"): map[string]any{
+			"name":  "peon-ping",
+			"owner": map[string]any{"name": "peon-ping"},
+			"plugins": []any{map[string]any{
+				"name":        "peon-ping",
+				"source":      "./",
+				"description": "Warcraft III Peon voice lines and notifications for Claude Code hooks",
+			}},
+		},
+		filepath.Join("hooks", "hooks.json"): map[string]any{
+			"description": "peon-ping sounds, notifications and action bar",
+			"hooks":       hooks,
+		},
+	}
+
+	for name, v := range files {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		writePluginFile(filepath.Join(dir, name), append(data, '\n'))
+	}
+
+	for _, c := range claudePluginCommands {
+		md := "---\ndescription: " + c.Description + "\n"
+		if c.Hint != "" {
+			md += "argument-hint: " + c.Hint + "\n"
+		}
+		md += "allowed-tools: Bash(" + command + ":*)\n---\n\n"
+		md += "!`" + command + " " + strings.ReplaceAll(c.Args, "{peon}", command) + "`\n\nReport the output above to the user in one short line.\n"
+		writePluginFile(filepath.Join(dir, "commands", c.Name+".md"), []byte(md))
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	fmt.Printf("peon-ping: exported Claude Code plugin to %s\n", dir)
+	fmt.Printf("Install with:\n  /plugin marketplace add %s\n  /plugin install peon-ping@peon-ping\n", dir)
+}
+
+// shellQuote quotes s for a POSIX shell, leaving plain paths as they are.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-+=:@,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellFirstWord returns the first word of a shell command with its quoting
+// removed: single quotes, double quotes and backslash escapes. It is the
+// inverse of shellQuote for the program name.
+func shellFirstWord(cmd string) string {
+	var w strings.Builder
+	cmd = strings.TrimLeft(cmd, " \t")
+	for i := 0; i < len(cmd); i++ {
+		switch c := cmd[i]; c {
+		case ' ', '\t', '\n', ';', '&', '|':
+			return w.String()
+		case '\'':
+			j := strings.IndexByte(cmd[i+1:], '\'')
+			if j < 0 {
+				return w.String() + cmd[i+1:]
+			}
+			w.WriteString(cmd[i+1 : i+1+j])
+			i += j + 1
+		case '"':
+			for i++; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("\"\\$`", cmd[i+1]) >= 0 {
+					i++
+				}
+				w.WriteByte(cmd[i])
+			}
+		case '\\':
+			if i+1 < len(cmd) {
+				i++
+				w.WriteByte(cmd[i])
+			}
+		default:
+			w.WriteByte(c)
+		}
+	}
+	return w.String()
+}
+
+func writePluginFile(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not create %s: %v\n", filepath.Dir(path), err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not write %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 )
 
 func runCLI(peonDir string, args []string) {
@@ -12,35 +13,36 @@ func runCLI(peonDir string, args []string) {
 		return
 	}
 
-	pausedFile := filepath.Join(peonDir, ".paused")
-
-	switch args[0] {
-	case "--pause":
-		f, err := os.Create(pausedFile)
+	store := openStore(peonDir)
+	setPaused := func(fn func(paused bool) bool) {
+		var now bool
+		err := store.Update(func(d *StoreData) error {
+			d.Paused = fn(d.Paused)
+			now = d.Paused
+			return nil
+		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		f.Close()
-		fmt.Println("peon-ping: sounds paused")
+		if now {
+			fmt.Println("peon-ping: sounds paused")
+		} else {
+			fmt.Println("peon-ping: sounds resumed")
+		}
+	}
+
+	switch args[0] {
+	case "--pause":
+		setPaused(func(bool) bool { return true })
 		os.Exit(0)
 
 	case "--resume":
-		os.Remove(pausedFile)
-		fmt.Println("peon-ping: sounds resumed")
+		setPaused(func(bool) bool { return false })
 		os.Exit(0)
 
 	case "--toggle":
-		if _, err := os.Stat(pausedFile); err == nil {
-			os.Remove(pausedFile)
-			fmt.Println("peon-ping: sounds resumed")
-		} else {
-			f, _ := os.Create(pausedFile)
-			if f != nil {
-				f.Close()
-			}
-			fmt.Println("peon-ping: sounds paused")
-		}
+		setPaused(func(p bool) bool { return !p })
 		os.Exit(0)
 
 	case "--dismiss":
@@ -70,11 +72,45 @@ func runCLI(peonDir string, args []string) {
 		os.Exit(0)
 
 	case "--status":
-		if _, err := os.Stat(pausedFile); err == nil {
+		d := store.Snapshot()
+		if d.Paused {
 			fmt.Println("peon-ping: paused")
 		} else {
 			fmt.Println("peon-ping: active")
 		}
+		if d.SafeMode {
+			fmt.Println("peon-ping: safe mode on")
+		}
+		os.Exit(0)
+
+	case "--safe-mode":
+		// Usage: peon --safe-mode [on|off]; no argument reports the state.
+		var on bool
+		err := store.Update(func(d *StoreData) error {
+			if len(args) > 1 {
+				switch strings.ToLower(args[1]) {
+				case "on", "true", "yes":
+					d.SafeMode = true
+				case "off", "false", "no":
+					d.SafeMode = false
+				default:
+					return fmt.Errorf("usage: peon --safe-mode [on|off]")
+				}
+			}
+			on = d.SafeMode
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if tags := loadConfig(peonDir).safeModeTags(); on && len(tags) == 0 {
+			fmt.Println("peon-ping: safe mode on, but safe_mode_tags is empty so nothing is skipped")
+		} else if on {
+			fmt.Printf("peon-ping: safe mode on, skipping sounds tagged %s\n", strings.Join(tags, ", "))
+		} else {
+			fmt.Println("peon-ping: safe mode off")
+		}
 		os.Exit(0)
 
 	case "--packs":
@@ -88,20 +124,16 @@ func runCLI(peonDir string, args []string) {
 			return packs[i].Name < packs[j].Name
 		})
 		for _, p := range packs {
-			display := p.DisplayName
-			if display == "" {
-				display = p.Name
-			}
 			marker := ""
 			if p.Name == cfg.ActivePack {
 				marker = " *"
 			}
-			fmt.Printf("  %-24s %s%s\n", p.Name, display, marker)
+			fmt.Printf("  %-24s %-28s %4d sounds %9s%s\n", p.Name, packDisplayName(p), countSounds(p), formatSize(dirSize(p.dir)), marker)
 		}
 		os.Exit(0)
 
 	case "--pack":
-		cfg := loadConfig(peonDir)
+		cfg := loadUserConfig(peonDir)
 		packs, err := listPacks(peonDir)
 		if err != nil || len(packs) == 0 {
 			fmt.Fprintln(os.Stderr, "Error: no packs found")
@@ -172,20 +204,21 @@ func runCLI(peonDir string, args []string) {
 			fmt.Fprintln(os.Stderr, "peon-ping: could not capture window handle")
 			os.Exit(1)
 		}
-		ls, err := loadStateLocked(peonDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-		if ls.State.WindowHandles == nil {
-			ls.State.WindowHandles = make(map[string]uint64)
-		}
 		sessionID := "_default"
 		if len(args) > 1 {
 			sessionID = args[1]
 		}
-		ls.State.WindowHandles[sessionID] = hwnd
-		ls.saveStateUnlock(peonDir)
+		err := store.Update(func(d *StoreData) error {
+			if d.State.WindowHandles == nil {
+				d.State.WindowHandles = make(map[string]uint64)
+			}
+			d.State.WindowHandles[sessionID] = hwnd
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		fmt.Printf("peon-ping: registered window %d for session %s\n", hwnd, sessionID)
 		os.Exit(0)
 
@@ -194,40 +227,183 @@ func runCLI(peonDir string, args []string) {
 		os.Exit(0)
 
 	case "--install-startup":
-		installStartupShortcut(peonDir)
+		if err := installStartupShortcut(peonDir); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 
 	case "--uninstall-startup":
-		uninstallStartupShortcut()
+		if err := uninstallStartupShortcut(); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 
 	case "--install-opencode":
-		installOpenCode()
+		if err := installOpenCode(); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 
 	case "--uninstall-opencode":
-		uninstallOpenCode()
+		if err := uninstallOpenCode(); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "--install-claude":
+		// Usage: peon --install-claude [--scope user|project|local] [--check]
+		scope, check := "", false
+		for i := 1; i < len(args); i++ {
+			switch {
+			case args[i] == "--scope" && i+1 < len(args):
+				scope = args[i+1]
+				i++
+			case args[i] == "--check":
+				check = true
+			}
+		}
+		if check {
+			if !checkClaudeHooks(peonDir, scope) {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		if err := installClaudeHooks(peonDir, scope); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "--uninstall-claude":
+		// Usage: peon --uninstall-claude [--scope user|project|local]
+		scope := ""
+		if len(args) > 2 && args[1] == "--scope" {
+			scope = args[2]
+		}
+		if err := uninstallClaudeHooks(scope); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "--export-claude-plugin":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: peon --export-claude-plugin <dir>")
+			os.Exit(1)
+		}
+		exportClaudePlugin(peonDir, args[1])
+		os.Exit(0)
+
+	case "--explain":
+		// Usage: peon --explain < payload.json
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil || len(input) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: peon --explain < payload.json")
+			os.Exit(1)
+		}
+		handleHook(peonDir, input, hookOptions{
+			DryRun:  true,
+			Explain: func(line string) { fmt.Println(line) },
+		})
+		os.Exit(0)
+
+	case "--record":
+		mode := ""
+		if len(args) > 1 {
+			mode = args[1]
+		}
+		setRecording(peonDir, mode)
+		os.Exit(0)
+
+	case "--replay":
+		runReplay(peonDir, args[1:])
+		os.Exit(0)
+
+	case "--stream":
+		// Usage: peon --stream [--results]
+		results := len(args) > 1 && args[1] == "--results"
+		runStream(peonDir, os.Stdin, os.Stdout, results)
+		os.Exit(0)
+
+	case "emit":
+		runEmit(peonDir, args[1:])
+		os.Exit(0)
+
+	case "run":
+		os.Exit(runWrapped(peonDir, args[1:]))
+
+	case "setup":
+		runSetup(peonDir, args[1:])
+		os.Exit(0)
+
+	case "uninstall":
+		runUninstall(peonDir, args[1:])
+		os.Exit(0)
+
+	case "doctor":
+		runDoctor(peonDir, args[1:])
+		os.Exit(0)
+
+	case "config":
+		runConfigCmd(peonDir, args[1:])
+		os.Exit(0)
+
+	case "pack":
+		runPackCmd(peonDir, args[1:])
+		os.Exit(0)
+
+	case "import-python":
+		importPython(peonDir, args[1:])
+		os.Exit(0)
+
+	case "migrate-dirs":
+		migrateDirs(args[1:])
 		os.Exit(0)
 
 	case "--help", "-h":
 		fmt.Print(`Usage: peon <command>
 
 Commands:
+  setup [--yes]        Interactive setup: hooks, plugins, pack, test event
+  uninstall [--purge]  Remove all hooks and plugins peon added
+  doctor [--json]      Diagnose why sounds or notifications don't work
+  config <command>     show, get, set, unset, edit, validate, schema
+                       (see 'peon config --help')
+  pack <command>       install, remove, rename (see 'peon pack --help')
+  import-python [dir]  Import config and state from a Python peon-ping install
+  migrate-dirs [--dry-run]
+                       Move config, packs and state to the XDG directories
+  emit [options]       Fire an event from a script (see 'peon emit --help')
+  run -- <command>     Run a command, play complete/error when it exits
   --pause              Mute sounds
   --resume             Unmute sounds
   --toggle             Toggle mute on/off
   --status             Check if paused or active
+  --safe-mode [on|off] Skip sounds tagged nsfw, loud or long (safe_mode_tags)
   --dismiss            Close all hanging notification windows
   --actionbar          Launch the persistent action bar
   --relaunch           Rebuild from source, install, restart action bar
   --install-startup    Add action bar to Windows startup
   --uninstall-startup  Remove action bar from Windows startup
+  --install-claude     Register hooks in Claude Code settings
+                       [--scope user|project|local] [--check]
+  --uninstall-claude   Remove hooks from Claude Code settings
+  --export-claude-plugin <dir>
+                       Write a Claude Code plugin with hooks + slash commands
   --install-opencode   Install bridge plugin for OpenCode
   --uninstall-opencode Remove OpenCode bridge plugin
   --packs              List available sound packs
   --pack <name>        Switch to a specific pack
   --pack               Cycle to the next pack
   --register <sid>     Register terminal window for session
+  --stream [--results] Handle newline-delimited events from stdin until EOF
+  --explain            Show what a payload on stdin would do, without doing it
+  --record on|off      Capture hook payloads (redacted) to capture.jsonl
+  --replay <file>      Replay a capture [--speed 10x|max] [--dry-run]
   --version            Show version
   --help               Show this help
 `)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Codex has no hook system, but runs its top-level `notify` program after
+// every agent turn, appending a JSON description as the last argument.
+// `peon emit` stops parsing flags at that argument, so it can be used as is.
+
+func codexConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".codex", "config.toml"), nil
+}
+
+// codexNotifyLine is the config.toml line that makes Codex call peon.
+func codexNotifyLine(peonDir string) string {
+	return fmt.Sprintf("notify = [%s, \"emit\", \"--type\", \"task_complete\"]", strconv.Quote(peonHookCommand(peonDir)))
+}
+
+// codexTopLevelNotify returns the index of the top-level `notify` line, or -1.
+// Keys after the first [table] header belong to that table and don't count.
+func codexTopLevelNotify(lines []string) int {
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "[") {
+			return -1
+		}
+		if strings.HasPrefix(t, "notify") && strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(t, "notify")), "=") {
+			return i
+		}
+	}
+	return -1
+}
+
+func installCodex(peonDir string) error {
+	path, err := codexConfigPath()
+	if err != nil {
+		return fmt.Errorf("could not find home directory: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	want := codexNotifyLine(peonDir)
+	lines := strings.Split(string(data), "\n")
+	if i := codexTopLevelNotify(lines); i >= 0 {
+		if !strings.Contains(lines[i], "peon") {
+			fmt.Fprintf(os.Stderr, "peon-ping: %s already has a notify program; not replacing it\n", path)
+			return nil
+		}
+		if strings.TrimSpace(lines[i]) == want {
+			fmt.Printf("peon-ping: Codex notify already set in %s\n", path)
+			return nil
+		}
+		lines[i] = want
+	} else {
+		// Top-level keys must come before the first table header.
+		lines = append([]string{want}, lines...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create %s: %w", filepath.Dir(path), err)
+	}
+	if err := atomicWriteFile(path, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	fmt.Printf("peon-ping: set Codex notify program in %s\n", path)
+	return nil
+}
+
+func uninstallCodex() error {
+	path, err := codexConfigPath()
+	if err != nil {
+		return fmt.Errorf("could not find home directory: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Println("peon-ping: Codex config not found")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	i := codexTopLevelNotify(lines)
+	if i < 0 || !strings.Contains(lines[i], "peon") {
+		fmt.Println("peon-ping: Codex notify program not set by peon")
+		return nil
+	}
+	lines = append(lines[:i], lines[i+1:]...)
+	if err := atomicWriteFile(path, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	fmt.Println("peon-ping: Codex notify program removed")
+	return nil
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
-	"syscall"
 )
 
 // Config represents config.json (user preferences).
@@ -15,20 +15,23 @@ type Config struct {
 	Categories           map[string]bool `json:"categories"`
 	AnnoyedThreshold     int             `json:"annoyed_threshold"`
 	AnnoyedWindowSeconds float64         `json:"annoyed_window_seconds"`
+	DebugLog             bool            `json:"debug_log,omitempty"`
+	PackRegistry         string          `json:"pack_registry,omitempty"`
+	PackRegistryHTTP     bool            `json:"pack_registry_allow_http,omitempty"`
+	ExcludeTags          []string        `json:"exclude_tags,omitempty"`
+	IncludeTags          []string        `json:"include_tags,omitempty"`
+	SafeModeTags         *[]string       `json:"safe_mode_tags,omitempty"` // nil = defaults; [] = none
+	Version              int             `json:"version"`
 }
 
-// State represents .state.json (runtime state).
+// State is the sound-picking and session state, kept in the Store.
 type State struct {
 	LastPlayed       map[string]string  `json:"last_played"`
 	PromptTimestamps []float64          `json:"prompt_timestamps"`
 	AgentSessions    []string           `json:"agent_sessions,omitempty"`
 	WindowHandles    map[string]uint64  `json:"window_handles,omitempty"`
-}
-
-// lockedState holds the state plus the open file handle for flock.
-type lockedState struct {
-	State *State
-	file  *os.File
+	PlayedAt         map[string]float64 `json:"played_at,omitempty"` // pack/file → unix seconds, for min_interval
+	Version          int                `json:"version"`
 }
 
 func defaultConfig() Config {
@@ -47,83 +50,45 @@ func defaultConfig() Config {
 		},
 		AnnoyedThreshold:     3,
 		AnnoyedWindowSeconds: 10,
+		Version:              configVersion,
 	}
 }
 
-func loadConfig(peonDir string) Config {
-	cfg := defaultConfig()
-	data, err := os.ReadFile(filepath.Join(peonDir, "config.json"))
-	if err != nil {
-		return cfg
-	}
-	// Unmarshal on top of defaults so missing fields keep defaults.
-	_ = json.Unmarshal(data, &cfg)
-	if cfg.ActivePack == "" {
-		cfg.ActivePack = "peon"
-	}
-	if cfg.Volume == 0 {
-		cfg.Volume = 0.5
-	}
-	if cfg.AnnoyedThreshold == 0 {
-		cfg.AnnoyedThreshold = 3
-	}
-	if cfg.AnnoyedWindowSeconds == 0 {
-		cfg.AnnoyedWindowSeconds = 10
-	}
-	return cfg
+// defaultSafeModeTags are the tags peon --safe-mode on excludes unless
+// safe_mode_tags says otherwise.
+func defaultSafeModeTags() []string {
+	return []string{"nsfw", "loud", "long"}
 }
 
-func saveConfig(peonDir string, cfg Config) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return err
+// safeModeTags returns the tags safe mode excludes: safe_mode_tags if set,
+// even to [], otherwise the defaults.
+func (c Config) safeModeTags() []string {
+	if c.SafeModeTags == nil {
+		return defaultSafeModeTags()
 	}
-	return os.WriteFile(filepath.Join(peonDir, "config.json"), data, 0644)
+	return *c.SafeModeTags
 }
 
-// loadStateLocked opens .state.json with an exclusive flock.
-// Caller MUST call saveStateUnlock when done.
-func loadStateLocked(peonDir string) (*lockedState, error) {
-	statePath := filepath.Join(peonDir, ".state.json")
-
-	f, err := os.OpenFile(statePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, err
-	}
-
-	// Acquire exclusive lock (blocking).
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
-		f.Close()
-		return nil, err
-	}
-
-	var st State
-	data, err := os.ReadFile(statePath)
-	if err == nil && len(data) > 0 {
-		_ = json.Unmarshal(data, &st)
-	}
-	if st.LastPlayed == nil {
-		st.LastPlayed = make(map[string]string)
-	}
-
-	return &lockedState{State: &st, file: f}, nil
+// loadConfig returns the effective config for the current directory. The
+// hook path uses loadConfigFor with the event's cwd instead.
+func loadConfig(peonDir string) Config {
+	cwd, _ := os.Getwd()
+	return loadConfigFor(peonDir, cwd)
 }
 
-// saveStateUnlock writes state and releases the flock.
-func (ls *lockedState) saveStateUnlock(peonDir string) error {
-	statePath := filepath.Join(peonDir, ".state.json")
-
-	data, err := json.Marshal(ls.State)
+// saveConfig writes the user config atomically. A corrupt existing file is
+// quarantined first rather than silently replaced.
+func saveConfig(peonDir string, cfg Config) error {
+	path := filepath.Join(peonDir, "config.json")
+	if old, err := os.ReadFile(path); err == nil {
+		if p := configSyntaxError(path, old); p != nil {
+			quarantineFile(path, old, fmt.Errorf("%s", p.Msg))
+		}
+	}
+	cfg.Version = configVersion
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
-		syscall.Flock(int(ls.file.Fd()), syscall.LOCK_UN)
-		ls.file.Close()
 		return err
 	}
-
-	err = os.WriteFile(statePath, data, 0644)
-
-	// Release lock and close.
-	syscall.Flock(int(ls.file.Fd()), syscall.LOCK_UN)
-	ls.file.Close()
-	return err
+	return atomicWriteFile(path, data)
 }
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const configUsage = `Usage: peon config <command>
+
+  show [--origin]           Print the effective config
+  get <key> [--origin]      Print one effective value
+  set <key> <value>         Validate and write a value
+  unset <key>               Remove a value from a layer
+  edit                      Open a layer in $EDITOR, then validate it
+  validate [file...]        Check config files (default: every layer)
+  schema                    Print the JSON Schema for config files
+
+set, unset and edit write the user config.json unless --project (.peon.json
+in the current directory or above) or --system is given. Keys are top-level
+names or categories.<name>.
+`
+
+// runConfigCmd implements `peon config <subcommand>`.
+func runConfigCmd(peonDir string, args []string) {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch sub {
+	case "show":
+		showConfig(peonDir, args[1:])
+	case "get":
+		getConfig(peonDir, args[1:])
+	case "set", "unset":
+		setConfig(peonDir, sub, args[1:])
+	case "edit":
+		editConfig(peonDir, args[1:])
+	case "validate":
+		if !validateConfigFiles(peonDir, args[1:]) {
+			os.Exit(1)
+		}
+	case "schema":
+		data, _ := json.MarshalIndent(configSchema(peonDir), "", "  ")
+		fmt.Println(string(data))
+	case "--help", "-h", "help":
+		fmt.Print(configUsage)
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		os.Exit(1)
+	}
+}
+
+// configTarget picks the layer file that set, unset and edit write to from
+// --user (default), --project or --system, and returns the other args.
+func configTarget(peonDir string, args []string) (path string, rest []string) {
+	path = filepath.Join(peonDir, "config.json")
+	for _, a := range args {
+		switch a {
+		case "--user":
+		case "--system":
+			path = systemConfigPath()
+		case "--project":
+			cwd, _ := os.Getwd()
+			if path = findProjectConfig(cwd); path == "" {
+				path = filepath.Join(cwd, projectConfigName)
+			}
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return path, rest
+}
+
+// configValueJSON converts a command-line value to JSON for key: strings are
+// taken literally, booleans accept on/off as well as true/false, and
+// anything else must already be valid JSON (numbers, arrays).
+func configValueJSON(key, value string) (json.RawMessage, error) {
+	kind := reflect.Bool
+	if !strings.HasPrefix(key, "categories.") {
+		f, ok := configField(key)
+		if !ok || key == "categories" {
+			return nil, fmt.Errorf("unknown key %q (use categories.<name> for categories)", key)
+		}
+		kind = f.Type.Kind()
+	}
+	switch kind {
+	case reflect.String:
+		return json.Marshal(value)
+	case reflect.Slice:
+		// A JSON array, or a comma-separated list: nsfw,loud
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			break
+		}
+		items := []string{}
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		return json.Marshal(items)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "on", "yes":
+			value = "true"
+		case "off", "no":
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", key)
+		}
+		return json.Marshal(b)
+	}
+	if !json.Valid([]byte(value)) {
+		return nil, fmt.Errorf("%q is not valid JSON", value)
+	}
+	return json.RawMessage(value), nil
+}
+
+// readConfigFile reads a layer file for modification, migrated to the
+// current version. A missing file is an empty object; a malformed one is an
+// error so it is never overwritten.
+func readConfigFile(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		v, _ := json.Marshal(configVersion)
+		return map[string]json.RawMessage{"version": v}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p := configSyntaxError(path, data); p != nil {
+		return nil, fmt.Errorf("%s", p)
+	}
+	var m map[string]json.RawMessage
+	json.Unmarshal(data, &m)
+	if err := migrate(m, configMigrations); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// writeConfigFile writes a layer file atomically, creating its directory if
+// needed.
+func writeConfigFile(path string, m map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return atomicWriteFile(path, append(data, '\n'))
+}
+
+// getConfig implements `peon config get <key> [--origin]`.
+func getConfig(peonDir string, args []string) {
+	var key string
+	withOrigin := false
+	for _, a := range args {
+		if a == "--origin" {
+			withOrigin = true
+		} else {
+			key = a
+		}
+	}
+	if key == "" {
+		fmt.Fprintln(os.Stderr, "Usage: peon config get <key> [--origin]")
+		os.Exit(1)
+	}
+	cwd, _ := os.Getwd()
+	cfg, origin := loadConfigOrigins(peonDir, cwd)
+	if key == "categories" {
+		data, _ := json.Marshal(cfg.Categories)
+		fmt.Println(string(data))
+		return
+	}
+	v, ok := flattenConfig(cfg)[key]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "peon-ping: unknown key %q\n", key)
+		os.Exit(1)
+	}
+	if withOrigin {
+		o := origin[key]
+		if o == "" {
+			o = "default"
+		}
+		fmt.Printf("%s  %s\n", v, o)
+		return
+	}
+	fmt.Println(v)
+}
+
+// setConfig implements `peon config set <key> <value>` and
+// `peon config unset <key>`.
+func setConfig(peonDir, sub string, args []string) {
+	path, rest := configTarget(peonDir, args)
+	if (sub == "set" && len(rest) != 2) || (sub == "unset" && len(rest) != 1) {
+		fmt.Fprint(os.Stderr, configUsage)
+		os.Exit(1)
+	}
+	key := rest[0]
+
+	m, err := readConfigFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+		os.Exit(1)
+	}
+	cats := make(map[string]json.RawMessage)
+	if raw, ok := m["categories"]; ok {
+		json.Unmarshal(raw, &cats)
+	}
+	cat, isCat := strings.CutPrefix(key, "categories.")
+
+	if sub == "set" {
+		raw, err := configValueJSON(key, rest[1])
+		if err == nil {
+			err = checkConfigValue(peonDir, key, raw)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		if isCat {
+			cats[cat] = raw
+		} else {
+			m[key] = raw
+		}
+	} else {
+		if isCat {
+			delete(cats, cat)
+		} else {
+			delete(m, key)
+		}
+	}
+	if len(cats) > 0 {
+		m["categories"], _ = json.Marshal(cats)
+	} else {
+		delete(m, "categories")
+	}
+
+	if err := writeConfigFile(path, m); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not write config: %v\n", err)
+		os.Exit(1)
+	}
+	if sub == "set" {
+		fmt.Printf("peon-ping: %s = %s in %s\n", key, rest[1], path)
+	} else {
+		fmt.Printf("peon-ping: removed %s from %s\n", key, path)
+	}
+}
+
+// editConfig implements `peon config edit`: open a layer file in $VISUAL or
+// $EDITOR and validate it afterwards, offering to reopen it until it passes.
+func editConfig(peonDir string, args []string) {
+	path, _ := configTarget(peonDir, args)
+	if !fileExists(path) {
+		if err := writeConfigFile(path, map[string]json.RawMessage{}); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		// Run through the shell so EDITOR="code --wait" works.
+		cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %s: %v\n", editor, err)
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			os.Exit(1)
+		}
+		problems := validateConfigData(peonDir, path, data)
+		if len(problems) == 0 {
+			fmt.Printf("peon-ping: %s is valid\n", path)
+			return
+		}
+		for _, pr := range problems {
+			fmt.Fprintln(os.Stderr, pr)
+		}
+		// Stop at EOF rather than reopening the editor forever.
+		fmt.Print("Edit again? (Y/n): ")
+		line, err := in.ReadString('\n')
+		if ans := strings.ToLower(strings.TrimSpace(line)); err != nil || ans == "n" || ans == "no" {
+			os.Exit(1)
+		}
+	}
+}
+
+// validateConfigFiles implements `peon config validate [file...]`. With no
+// files it checks every layer file that exists. Reports whether all passed.
+func validateConfigFiles(peonDir string, files []string) bool {
+	if len(files) == 0 {
+		cwd, _ := os.Getwd()
+		for _, l := range configLayerPaths(peonDir, cwd) {
+			if fileExists(l.Path) {
+				files = append(files, l.Path)
+			}
+		}
+	}
+	if len(files) == 0 {
+		fmt.Println("peon-ping: no config files, using defaults")
+		return true
+	}
+	ok := true
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", f, err)
+			ok = false
+			continue
+		}
+		problems := validateConfigData(peonDir, f, data)
+		for _, pr := range problems {
+			fmt.Fprintln(os.Stderr, pr)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", f)
+		} else {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// showConfig prints the effective config for the current directory. With
+// --origin each value is listed with the layer that set it.
+func showConfig(peonDir string, args []string) {
+	withOrigin := false
+	for _, a := range args {
+		if a == "--origin" {
+			withOrigin = true
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	cfg, origin := loadConfigOrigins(peonDir, cwd)
+	warnConfigProblems(peonDir, cwd)
+	if !withOrigin {
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	values := flattenConfig(cfg)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	width := 0
+	for _, k := range keys {
+		width = max(width, len(k))
+	}
+	for _, k := range keys {
+		o := origin[k]
+		if o == "" {
+			o = "default"
+		}
+		fmt.Printf("%-*s  %-10s  %s\n", width, k, values[k], o)
+	}
+
+	var files []string
+	for _, l := range configLayers(peonDir, cwd) {
+		if l.Path != "" {
+			files = append(files, l.Name+"="+l.Path)
+		}
+	}
+	if len(files) > 0 {
+		fmt.Printf("\nlayers: %s\n", strings.Join(files, ", "))
+	}
+}
+
+// flattenConfig maps every config key to its JSON-encoded value, with one
+// "categories.<name>" entry per category. Fields are read directly rather
+// than via json.Marshal so omitempty keys still appear.
+func flattenConfig(cfg Config) map[string]string {
+	values := make(map[string]string)
+	v := reflect.ValueOf(cfg)
+	for i, k := range configKeys() {
+		if k == "categories" {
+			continue
+		}
+		data, _ := json.Marshal(v.Field(i).Interface())
+		values[k] = string(data)
+	}
+	for c, on := range cfg.Categories {
+		values["categories."+c] = fmt.Sprint(on)
+	}
+	// Unset means the defaults; show what applies.
+	data, _ := json.Marshal(cfg.safeModeTags())
+	values["safe_mode_tags"] = string(data)
+	return values
+}
+
+// warnConfigProblems prints validation problems in the layer files to
+// stderr, since loading skips malformed files and ignores bad values.
+func warnConfigProblems(peonDir, cwd string) {
+	for _, l := range configLayerPaths(peonDir, cwd) {
+		data, err := os.ReadFile(l.Path)
+		if err != nil {
+			continue
+		}
+		for _, pr := range validateConfigData(peonDir, l.Path, data) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", pr)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Configuration is merged from several layers, lowest priority first:
+//
+//	default  built-in defaults (defaultConfig)
+//	system   /etc/peon-ping/config.json (PEON_SYSTEM_CONFIG overrides the path)
+//	user     <peonDir>/config.json
+//	project  the nearest .peon.json walking up from the event's cwd
+//	env      PEON_<KEY> variables, e.g. PEON_VOLUME=0.3, PEON_CATEGORIES_GREETING=false
+//
+// Each layer only overrides the keys it sets; categories merge per category.
+
+// projectConfigName is the project-local config file name.
+const projectConfigName = ".peon.json"
+
+// configLayer is one source of config values.
+type configLayer struct {
+	Name string                     // default, system, user, project or env
+	Path string                     // file the values came from; empty for env
+	Data map[string]json.RawMessage // top-level keys set by this layer
+}
+
+// systemConfigPath returns the system-wide config file path.
+func systemConfigPath() string {
+	if p := os.Getenv("PEON_SYSTEM_CONFIG"); p != "" {
+		return p
+	}
+	return "/etc/peon-ping/config.json"
+}
+
+// findProjectConfig walks up from dir looking for .peon.json. Returns "" if
+// dir is empty or no file is found before the filesystem root.
+func findProjectConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	for {
+		p := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readConfigLayer loads a config file as a map of top-level keys. Missing or
+// malformed files yield a nil map, so a broken layer is skipped rather than
+// breaking the hook; parse errors go to the debug log with their position
+// (and are reported by peon config validate and peon doctor).
+func readConfigLayer(path string) map[string]json.RawMessage {
+	m, err := cachedLoad(path, func(data []byte) (map[string]json.RawMessage, error) {
+		if p := configSyntaxError(path, data); p != nil {
+			return nil, errors.New(p.String())
+		}
+		var m map[string]json.RawMessage
+		json.Unmarshal(data, &m)
+		if err := migrate(m, configMigrations); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return m, nil
+	})
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logError("config", err)
+		}
+		return nil
+	}
+	return m
+}
+
+// configKeys returns the JSON names of Config's fields.
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// envVarFor returns the environment variable that overrides a config key;
+// "categories.greeting" maps to PEON_CATEGORIES_GREETING.
+func envVarFor(key string) string {
+	return "PEON_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envConfigLayer collects PEON_* overrides. Values are parsed as JSON when
+// possible (numbers, booleans) and taken as plain strings otherwise, so
+// PEON_ACTIVE_PACK=glados works without quoting.
+func envConfigLayer() configLayer {
+	value := func(s string) json.RawMessage {
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+		b, _ := json.Marshal(s)
+		return b
+	}
+	data := make(map[string]json.RawMessage)
+	for _, k := range configKeys() {
+		if k == "categories" || k == "version" {
+			continue
+		}
+		v, ok := os.LookupEnv(envVarFor(k))
+		if !ok {
+			continue
+		}
+		if f, _ := configField(k); f.Type.Kind() == reflect.Slice {
+			// Lists may be given as a,b,c.
+			if raw, err := configValueJSON(k, v); err == nil {
+				data[k] = raw
+			}
+			continue
+		}
+		data[k] = value(v)
+	}
+	prefix := envVarFor("categories.")
+	cats := make(map[string]json.RawMessage)
+	for _, kv := range os.Environ() {
+		name, v, _ := strings.Cut(kv, "=")
+		if cat, ok := strings.CutPrefix(name, prefix); ok && cat != "" {
+			cats[strings.ToLower(cat)] = value(v)
+		}
+	}
+	if len(cats) > 0 {
+		data["categories"], _ = json.Marshal(cats)
+	}
+	return configLayer{Name: "env", Data: data}
+}
+
+// configLayerPaths returns the file-backed layers that may apply in cwd,
+// lowest priority first, without reading them. The files may not exist.
+func configLayerPaths(peonDir, cwd string) []configLayer {
+	layers := []configLayer{
+		{Name: "system", Path: systemConfigPath()},
+		{Name: "user", Path: filepath.Join(peonDir, "config.json")},
+	}
+	if p := findProjectConfig(cwd); p != "" {
+		layers = append(layers, configLayer{Name: "project", Path: p})
+	}
+	return layers
+}
+
+// configLayers returns the layers that apply in cwd, lowest priority first.
+// Layers with no file are omitted.
+func configLayers(peonDir, cwd string) []configLayer {
+	var layers []configLayer
+	for _, l := range configLayerPaths(peonDir, cwd) {
+		if l.Data = readConfigLayer(l.Path); l.Data != nil {
+			layers = append(layers, l)
+		}
+	}
+	if env := envConfigLayer(); len(env.Data) > 0 {
+		layers = append(layers, env)
+	}
+	return layers
+}
+
+// describe names where a key's value came from, for config show --origin.
+func (l configLayer) describe(key string) string {
+	if l.Path == "" {
+		return l.Name + " (" + envVarFor(key) + ")"
+	}
+	return l.Name + " (" + l.Path + ")"
+}
+
+// mergeConfigLayers applies layers on top of the defaults. It returns the
+// result and, for every key, the layer that set it ("categories.<name>" for
+// individual categories). Values of the wrong type are ignored.
+func mergeConfigLayers(layers []configLayer) (Config, map[string]string) {
+	cfg := defaultConfig()
+	origin := make(map[string]string)
+	for _, k := range configKeys() {
+		if k != "categories" {
+			origin[k] = "default"
+		}
+	}
+	for c := range cfg.Categories {
+		origin["categories."+c] = "default"
+	}
+
+	for _, l := range layers {
+		for k, v := range l.Data {
+			if k == "categories" {
+				var cats map[string]json.RawMessage
+				if json.Unmarshal(v, &cats) != nil {
+					continue
+				}
+				for c, raw := range cats {
+					var on bool
+					if json.Unmarshal(raw, &on) != nil {
+						continue
+					}
+					cfg.Categories[c] = on
+					origin["categories."+c] = l.describe("categories." + c)
+				}
+				continue
+			}
+			if _, known := origin[k]; !known {
+				continue
+			}
+			// Decode the single key onto a copy so a type error can't leave
+			// cfg half-updated.
+			one, _ := json.Marshal(map[string]json.RawMessage{k: v})
+			next := cfg
+			if json.Unmarshal(one, &next) != nil {
+				continue
+			}
+			next.Categories = cfg.Categories
+			cfg = next
+			origin[k] = l.describe(k)
+		}
+	}
+
+	if cfg.ActivePack == "" {
+		cfg.ActivePack = "peon"
+	}
+	if cfg.AnnoyedThreshold == 0 {
+		cfg.AnnoyedThreshold = 3
+	}
+	if cfg.AnnoyedWindowSeconds == 0 {
+		cfg.AnnoyedWindowSeconds = 10
+	}
+	// Every layer was migrated on load, so the result is current.
+	cfg.Version = configVersion
+	return cfg, origin
+}
+
+// loadConfigFor returns the effective config for a project directory.
+func loadConfigFor(peonDir, cwd string) Config {
+	cfg, _ := mergeConfigLayers(configLayers(peonDir, cwd))
+	return cfg
+}
+
+// loadUserConfig returns the defaults plus the user's config.json only. Use
+// it before saveConfig so values from other layers aren't written back into
+// the user file.
+func loadUserConfig(peonDir string) Config {
+	var layers []configLayer
+	path := filepath.Join(peonDir, "config.json")
+	if data := readConfigLayer(path); data != nil {
+		layers = append(layers, configLayer{Name: "user", Path: path, Data: data})
+	}
+	cfg, _ := mergeConfigLayers(layers)
+	return cfg
+}
+
+// loadConfigOrigins is loadConfigFor plus where each value came from.
+func loadConfigOrigins(peonDir, cwd string) (Config, map[string]string) {
+	return mergeConfigLayers(configLayers(peonDir, cwd))
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configDocs describes each config key; it feeds the JSON Schema so editors
+// can show it on hover.
+var configDocs = map[string]string{
+	"active_pack":              "Sound pack to play (a directory under packs/).",
+	"volume":                   "Playback volume from 0 (silent) to 1.",
+	"enabled":                  "Set to false to turn peon off entirely.",
+	"categories":               "Turn individual sound categories on or off.",
+	"annoyed_threshold":        "Prompts within the window that trigger an annoyed sound.",
+	"annoyed_window_seconds":   "Window for annoyed_threshold, in seconds.",
+	"debug_log":                "Append a JSON line per invocation to peon.log.",
+	"pack_registry":            "URL or file path of a pack registry index.json. Only read from the user config and environment.",
+	"pack_registry_allow_http": "Allow plain http:// registry and pack URLs. Only read from the user config and environment.",
+	"exclude_tags":             "Never play sounds with any of these tags.",
+	"include_tags":             "Prefer sounds with one of these tags, when a category has any.",
+	"safe_mode_tags":           "Tags excluded while safe mode is on (peon --safe-mode on).",
+	"version":                  "Config file format version; peon sets and upgrades it.",
+}
+
+// configField returns the Config struct field for a top-level JSON key.
+// Pointer fields (keys where unset differs from empty) report the type they
+// point to, which is what the key's value must be.
+func configField(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == key {
+			f := t.Field(i)
+			if f.Type.Kind() == reflect.Pointer {
+				f.Type = f.Type.Elem()
+			}
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// knownCategories returns the sound categories config can switch, sorted.
+func knownCategories() []string {
+	var cats []string
+	for c := range defaultConfig().Categories {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// jsonTypeName describes what JSON a Go type expects, for error messages.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "an array"
+	case reflect.Map:
+		return "an object"
+	}
+	return t.String()
+}
+
+// checkConfigValue validates the JSON value of one key. key may be a
+// top-level key or "categories.<name>".
+func checkConfigValue(peonDir, key string, raw json.RawMessage) error {
+	if cat, ok := strings.CutPrefix(key, "categories."); ok {
+		if _, known := defaultConfig().Categories[cat]; !known {
+			return fmt.Errorf("unknown category %q (known: %s)", cat, strings.Join(knownCategories(), ", "))
+		}
+		var on bool
+		if json.Unmarshal(raw, &on) != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		return nil
+	}
+
+	f, ok := configField(key)
+	if !ok {
+		return fmt.Errorf("unknown key %q", key)
+	}
+	v := reflect.New(f.Type)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return fmt.Errorf("%s must be %s", key, jsonTypeName(f.Type))
+	}
+	switch key {
+	case "volume":
+		if x := v.Elem().Float(); x < 0 || x > 1 {
+			return fmt.Errorf("volume must be between 0 and 1, got %g", x)
+		}
+	case "annoyed_threshold":
+		if x := v.Elem().Int(); x < 1 {
+			return fmt.Errorf("annoyed_threshold must be at least 1, got %d", x)
+		}
+	case "annoyed_window_seconds":
+		if x := v.Elem().Float(); x <= 0 {
+			return fmt.Errorf("annoyed_window_seconds must be positive, got %g", x)
+		}
+	case "version":
+		if x := v.Elem().Int(); x < 0 || x > int64(configVersion) {
+			return fmt.Errorf("version %d is not supported by this peon (newest is %d)", x, configVersion)
+		}
+	case "active_pack":
+		name := v.Elem().String()
+		if !fileExists(filepath.Join(packsDir(peonDir), name, "manifest.json")) {
+			return fmt.Errorf("pack %q is not installed (see peon --packs)", name)
+		}
+	}
+	return nil
+}
+
+// configProblem is a validation error at a position in a config file.
+// Line and Col are 1-based; zero means the position is unknown.
+type configProblem struct {
+	Path      string
+	Line, Col int
+	Msg       string
+}
+
+func (p configProblem) String() string {
+	if p.Line == 0 {
+		return p.Path + ": " + p.Msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.Path, p.Line, p.Col, p.Msg)
+}
+
+// lineCol converts a byte offset in data to a 1-based line and column.
+func lineCol(data []byte, off int64) (int, int) {
+	if off > int64(len(data)) {
+		off = int64(len(data))
+	}
+	before := data[:off]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(off) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// configSyntaxError returns a positioned problem if data isn't a JSON
+// object, or nil.
+func configSyntaxError(path string, data []byte) *configProblem {
+	var m map[string]json.RawMessage
+	err := json.Unmarshal(data, &m)
+	if err == nil && m == nil {
+		err = errors.New("config must be a JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+	p := &configProblem{Path: path, Msg: err.Error()}
+	var syn *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syn):
+		// Offset is just past the offending byte.
+		p.Line, p.Col = lineCol(data, max(syn.Offset-1, 0))
+	case errors.As(err, &typ):
+		p.Line, p.Col = lineCol(data, typ.Offset)
+		p.Msg = "config must be a JSON object, not " + typ.Value
+	}
+	return p
+}
+
+// configKeyOffsets maps each top-level key (and "categories.<name>") to the
+// byte offset of its name in data, for positioning validation errors.
+func configKeyOffsets(data []byte) map[string]int64 {
+	offs := make(map[string]int64)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var walk func(prefix string) bool
+	walk = func(prefix string) bool {
+		if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+			return false
+		}
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return false
+			}
+			k, _ := t.(string)
+			offs[prefix+k] = dec.InputOffset() - int64(len(k)) - 2
+			if prefix == "" && k == "categories" {
+				if !walk("categories.") {
+					return false
+				}
+				continue
+			}
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				return false
+			}
+		}
+		_, err := dec.Token()
+		return err == nil
+	}
+	walk("")
+	return offs
+}
+
+// validateConfigData checks a config file's contents: JSON syntax, known
+// keys and categories, value types and ranges, and that active_pack is
+// installed. A "$schema" key is allowed for editor support.
+func validateConfigData(peonDir, path string, data []byte) []configProblem {
+	if p := configSyntaxError(path, data); p != nil {
+		return []configProblem{*p}
+	}
+	var m map[string]json.RawMessage
+	json.Unmarshal(data, &m)
+	offs := configKeyOffsets(data)
+
+	var problems []configProblem
+	add := func(key string, err error) {
+		p := configProblem{Path: path, Msg: err.Error()}
+		if off, ok := offs[key]; ok {
+			p.Line, p.Col = lineCol(data, off)
+		}
+		problems = append(problems, p)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch k {
+		case "$schema":
+		case "categories":
+			var cats map[string]json.RawMessage
+			if json.Unmarshal(m[k], &cats) != nil {
+				add(k, errors.New("categories must be an object"))
+				continue
+			}
+			names := make([]string, 0, len(cats))
+			for c := range cats {
+				names = append(names, c)
+			}
+			sort.Strings(names)
+			for _, c := range names {
+				if err := checkConfigValue(peonDir, "categories."+c, cats[c]); err != nil {
+					add("categories."+c, err)
+				}
+			}
+		default:
+			if err := checkConfigValue(peonDir, k, m[k]); err != nil {
+				add(k, err)
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Col < problems[j].Col
+	})
+	return problems
+}
+
+// configSchema returns a JSON Schema (draft 2020-12) for config files. It is
+// derived from Config so new keys show up automatically; installed packs are
+// offered as examples for active_pack.
+func configSchema(peonDir string) map[string]any {
+	props := map[string]any{
+		"$schema": map[string]any{"type": "string"},
+	}
+	for _, k := range configKeys() {
+		f, _ := configField(k)
+		p := map[string]any{"description": configDocs[k]}
+		switch f.Type.Kind() {
+		case reflect.Bool:
+			p["type"] = "boolean"
+		case reflect.Int, reflect.Int64:
+			p["type"] = "integer"
+		case reflect.Float64:
+			p["type"] = "number"
+		case reflect.String:
+			p["type"] = "string"
+		case reflect.Slice:
+			p["type"] = "array"
+			p["items"] = map[string]any{"type": "string"}
+		case reflect.Map:
+			p["type"] = "object"
+		}
+		props[k] = p
+	}
+
+	volume := props["volume"].(map[string]any)
+	volume["minimum"], volume["maximum"] = 0, 1
+	props["annoyed_threshold"].(map[string]any)["minimum"] = 1
+	props["annoyed_window_seconds"].(map[string]any)["exclusiveMinimum"] = 0
+
+	cats := make(map[string]any)
+	for _, c := range knownCategories() {
+		cats[c] = map[string]any{"type": "boolean"}
+	}
+	categories := props["categories"].(map[string]any)
+	categories["properties"] = cats
+	categories["additionalProperties"] = false
+
+	if packs, err := listPacks(peonDir); err == nil && len(packs) > 0 {
+		var names []string
+		for _, pk := range packs {
+			names = append(names, pk.Name)
+		}
+		sort.Strings(names)
+		props["active_pack"].(map[string]any)["examples"] = names
+	}
+
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "peon-ping config",
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
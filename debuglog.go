@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The debug log is an opt-in JSON-lines file with one record per hook
+// invocation: what was detected and decided, the backend commands run, the
+// errors the hook path otherwise swallows, and how long each stage took.
+// Enable it with "debug_log": true in config.json, or PEON_LOG=1 (default
+// location) / PEON_LOG=<path>.
+
+// debugLogMaxSize is the size at which the log is rotated to <log>.1.
+const debugLogMaxSize = 1 << 20
+
+// invocationLog is one debug log record.
+type invocationLog struct {
+	Time     time.Time          `json:"ts"`
+	PID      int                `json:"pid"`
+	Harness  string             `json:"harness,omitempty"`
+	Event    string             `json:"event,omitempty"`
+	Session  string             `json:"session_id,omitempty"`
+	Route    *Route             `json:"route,omitempty"`
+	Sound    string             `json:"sound,omitempty"`
+	Skipped  string             `json:"skipped,omitempty"`
+	Commands [][]string         `json:"commands,omitempty"`
+	Errors   []string           `json:"errors,omitempty"`
+	Locks    []lockWait         `json:"locks,omitempty"`
+	Timings  map[string]float64 `json:"timings_ms"`
+	TotalMS  float64            `json:"total_ms"`
+
+	mu   sync.Mutex
+	path string // log file
+}
+
+// Each invocation owns its record and passes it along in hookOptions.Log;
+// a nil record means logging is off, and every method is then a no-op.
+// Helpers deep in the backends, locks and config loading have no record to
+// hand, so they report to the newest ambient one. An invocation leaves the
+// ambient list while it blocks on a permission answer, so in --stream mode
+// the events handled meanwhile don't log into it.
+var ambientLogs struct {
+	sync.Mutex
+	list []*invocationLog
+}
+
+// debugLogPath returns where to write the log, or "" if logging is off.
+func debugLogPath(peonDir string) string {
+	switch v := os.Getenv("PEON_LOG"); v {
+	case "", "0":
+		if loadConfig(peonDir).DebugLog {
+			return filepath.Join(stateDir(peonDir), "peon.log")
+		}
+		return ""
+	case "1":
+		return filepath.Join(stateDir(peonDir), "peon.log")
+	default:
+		return v
+	}
+}
+
+// startInvocationLog starts an ambient record, or returns nil if logging is
+// off. The caller owns it and must call finish.
+func startInvocationLog(peonDir string) *invocationLog {
+	path := debugLogPath(peonDir)
+	if path == "" {
+		return nil
+	}
+	l := &invocationLog{Time: time.Now(), PID: os.Getpid(), Timings: make(map[string]float64), path: path}
+	l.setAmbient(true)
+	return l
+}
+
+// setAmbient adds the record to, or takes it out of, the ambient list.
+func (l *invocationLog) setAmbient(on bool) {
+	if l == nil {
+		return
+	}
+	ambientLogs.Lock()
+	defer ambientLogs.Unlock()
+	i := slices.Index(ambientLogs.list, l)
+	switch {
+	case on && i < 0:
+		ambientLogs.list = append(ambientLogs.list, l)
+	case !on && i >= 0:
+		ambientLogs.list = slices.Delete(ambientLogs.list, i, i+1)
+	}
+}
+
+// finish writes the record.
+func (l *invocationLog) finish() {
+	if l == nil {
+		return
+	}
+	l.setAmbient(false)
+	l.mu.Lock()
+	l.TotalMS = msSince(l.Time)
+	data, err := json.Marshal(l)
+	l.mu.Unlock()
+	if err == nil {
+		writeDebugLog(l.path, data)
+	}
+}
+
+// update applies fn to the record.
+func (l *invocationLog) update(fn func(l *invocationLog)) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(l)
+}
+
+// stage starts timing a pipeline stage; call the returned func when done.
+func (l *invocationLog) stage(name string) func() {
+	start := time.Now()
+	return func() {
+		l.update(func(l *invocationLog) { l.Timings[name] += msSince(start) })
+	}
+}
+
+// addError records an error the hook path would otherwise ignore.
+func (l *invocationLog) addError(where string, err error) {
+	if err == nil {
+		return
+	}
+	l.update(func(l *invocationLog) { l.Errors = append(l.Errors, where+": "+err.Error()) })
+}
+
+// logUpdate applies fn to the newest ambient record, if any.
+func logUpdate(fn func(l *invocationLog)) {
+	ambientLogs.Lock()
+	var l *invocationLog
+	if n := len(ambientLogs.list); n > 0 {
+		l = ambientLogs.list[n-1]
+	}
+	ambientLogs.Unlock()
+	l.update(fn)
+}
+
+// logCommand records a backend command line (audio, notification, helper).
+func logCommand(name string, args ...string) {
+	logUpdate(func(l *invocationLog) { l.Commands = append(l.Commands, append([]string{name}, args...)) })
+}
+
+// logError records an error the hook path would otherwise ignore.
+func logError(where string, err error) {
+	if err == nil {
+		return
+	}
+	logUpdate(func(l *invocationLog) { l.Errors = append(l.Errors, where+": "+err.Error()) })
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// writeDebugLog appends a record, rotating the file once it grows too big.
+func writeDebugLog(path string, data []byte) {
+	if info, err := os.Stat(path); err == nil && info.Size() > debugLogMaxSize {
+		os.Rename(path, path+".1")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: debug log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
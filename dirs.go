@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// peon keeps four kinds of files. In the legacy layout (~/.claude/hooks/peon-ping,
+// or CLAUDE_PEON_DIR) they share one directory. In the XDG layout they are
+// split:
+//
+//	config   $XDG_CONFIG_HOME/peon-ping   config.json
+//	data     $XDG_DATA_HOME/peon-ping     packs/
+//	state    $XDG_STATE_HOME/peon-ping    .store.json, .actionbar.json, peon.log, capture.jsonl
+//	runtime  $XDG_RUNTIME_DIR/peon-ping   locks and the helper copy
+//
+// The config dir is the "peon dir" passed around; dirsFor maps it to the rest.
+
+// peonDirs says where each kind of file lives.
+type peonDirs struct {
+	Config  string
+	Data    string
+	State   string
+	Runtime string
+}
+
+// xdgBase returns an XDG base directory. Per the spec, relative values are
+// ignored in favour of the default under $HOME.
+func xdgBase(env, def string) string {
+	if d := os.Getenv(env); filepath.IsAbs(d) {
+		return d
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, def)
+}
+
+// xdgPeonDirs returns the XDG layout. Without XDG_RUNTIME_DIR (common on WSL
+// and macOS) runtime files go in the state dir.
+func xdgPeonDirs() peonDirs {
+	d := peonDirs{
+		Config: filepath.Join(xdgBase("XDG_CONFIG_HOME", ".config"), "peon-ping"),
+		Data:   filepath.Join(xdgBase("XDG_DATA_HOME", filepath.Join(".local", "share")), "peon-ping"),
+		State:  filepath.Join(xdgBase("XDG_STATE_HOME", filepath.Join(".local", "state")), "peon-ping"),
+	}
+	d.Runtime = d.State
+	if r := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(r) {
+		d.Runtime = filepath.Join(r, "peon-ping")
+	}
+	return d
+}
+
+// legacyPeonDir is where peon kept everything before XDG support.
+func legacyPeonDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".claude", "hooks", "peon-ping")
+}
+
+// defaultPeonDir picks the peon dir: CLAUDE_PEON_DIR if set, the XDG config
+// dir if it exists, the legacy dir if it holds a config or packs, and XDG for
+// new installs. The legacy dir existing is not enough: the binary is always
+// installed there.
+func defaultPeonDir() string {
+	if d := os.Getenv("CLAUDE_PEON_DIR"); d != "" {
+		return d
+	}
+	xdg := xdgPeonDirs().Config
+	if fileExists(xdg) {
+		return xdg
+	}
+	legacy := legacyPeonDir()
+	if fileExists(filepath.Join(legacy, "config.json")) || fileExists(filepath.Join(legacy, "packs")) {
+		return legacy
+	}
+	return xdg
+}
+
+// dirsFor returns the layout for a peon dir: split when it is the XDG config
+// dir, everything in peonDir otherwise.
+func dirsFor(peonDir string) peonDirs {
+	if x := xdgPeonDirs(); filepath.Clean(peonDir) == x.Config {
+		return x
+	}
+	return peonDirs{Config: peonDir, Data: peonDir, State: peonDir, Runtime: peonDir}
+}
+
+// packsDir is where sound packs are installed.
+func packsDir(peonDir string) string {
+	return filepath.Join(dirsFor(peonDir).Data, "packs")
+}
+
+// stateDir holds the store, the helper's action bar view and mailbox, the
+// debug log and captures. It is created on demand.
+func stateDir(peonDir string) string {
+	d := dirsFor(peonDir).State
+	os.MkdirAll(d, 0755)
+	return d
+}
+
+// runtimeDir holds lock files. It is created on demand, private to the user.
+func runtimeDir(peonDir string) string {
+	d := dirsFor(peonDir).Runtime
+	os.MkdirAll(d, 0700)
+	return d
+}
+
+// binDir is where the peon and peon-helper.exe binaries are installed. In
+// the legacy layout that is the peon dir. The XDG layout has no place for
+// them, so they stay in the legacy dir, or wherever the running binary is.
+func binDir(peonDir string) string {
+	if d := dirsFor(peonDir); d.Config != d.Data {
+		if legacy := legacyPeonDir(); fileExists(filepath.Join(legacy, "peon")) {
+			return legacy
+		}
+		if exe, err := os.Executable(); err == nil {
+			return filepath.Dir(exe)
+		}
+	}
+	return peonDir
+}
+
+// helperCacheDir is where findHelper copies peon-helper.exe.
+func helperCacheDir() string {
+	if r := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(r) {
+		d := filepath.Join(r, "peon-ping")
+		if os.MkdirAll(d, 0700) == nil {
+			return d
+		}
+	}
+	return os.TempDir()
+}
+
+// migrateDirs implements `peon migrate-dirs [--dry-run]`: move config, packs
+// and state from the legacy dir into the XDG layout. Binaries (peon,
+// peon-helper.exe) stay put because harness hooks point at them.
+func migrateDirs(args []string) {
+	dryRun := len(args) > 0 && args[0] == "--dry-run"
+	src := os.Getenv("CLAUDE_PEON_DIR")
+	if src == "" {
+		src = legacyPeonDir()
+	}
+	dst := xdgPeonDirs()
+	if !fileExists(src) {
+		fmt.Fprintf(os.Stderr, "peon-ping: nothing to migrate, %s does not exist\n", src)
+		os.Exit(1)
+	}
+	if filepath.Clean(src) == dst.Config {
+		fmt.Println("peon-ping: already using XDG directories")
+		return
+	}
+
+	// Fold any pre-store state files into .store.json first, so there is
+	// one file to move.
+	if dryRun {
+		for _, name := range legacyStoreFiles {
+			if fileExists(filepath.Join(src, name)) {
+				fmt.Printf("  %s → %s (imported)\n", filepath.Join(src, name), filepath.Join(dst.State, ".store.json"))
+			}
+		}
+	} else {
+		if err := openStore(src).Update(func(*StoreData) error { return nil }); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: could not open store in %s: %v\n", src, err)
+			os.Exit(1)
+		}
+	}
+
+	moves := []struct{ name, dir string }{
+		{"config.json", dst.Config},
+		{"packs.d", dst.Config},
+		{"packs", dst.Data},
+		{".store.json", dst.State},
+		{".actionbar.json", dst.State},
+		{".record", dst.State},
+		{"capture.jsonl", dst.State},
+		{"peon.log", dst.State},
+		{"peon.log.1", dst.State},
+	}
+	failed := false
+	for _, m := range moves {
+		from := filepath.Join(src, m.name)
+		to := filepath.Join(m.dir, m.name)
+		if !fileExists(from) {
+			continue
+		}
+		if fileExists(to) {
+			fmt.Printf("  skip %s: %s already exists\n", m.name, to)
+			continue
+		}
+		fmt.Printf("  %s → %s\n", from, to)
+		if dryRun {
+			continue
+		}
+		if err := movePath(from, to); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+			failed = true
+		}
+	}
+	if dryRun {
+		return
+	}
+	for _, lock := range []string{".store.lock", ".store.lock.excl"} {
+		os.Remove(filepath.Join(src, lock))
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Printf("peon-ping: now using %s\n", dst.Config)
+	if os.Getenv("CLAUDE_PEON_DIR") != "" {
+		fmt.Println("  unset CLAUDE_PEON_DIR so peon finds the new location")
+	}
+	if detectPlatform() == "wsl" {
+		fmt.Println("  run 'peon --actionbar-restart' (and 'peon --install-startup' if you use it) so the action bar follows")
+	}
+}
+
+// movePath renames from to to, creating the parent dir, and falls back to
+// copy-and-delete across filesystems.
+func movePath(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	err := filepath.WalkDir(from, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(from, p)
+		target := filepath.Join(to, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(p, target)
+	})
+	if err != nil {
+		return fmt.Errorf("moving %s: %w", from, err)
+	}
+	return os.RemoveAll(from)
+}
+
+// copyFile copies a regular file, keeping its permission bits.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
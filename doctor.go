@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// doctorCheck is the outcome of one `peon doctor` check.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "pass", "warn" or "fail"
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// runDoctor implements `peon doctor [--json]`. The hook path swallows every
+// error so it never disturbs the harness; doctor is where they surface.
+// Exits non-zero if any check fails.
+func runDoctor(peonDir string, args []string) {
+	asJSON := len(args) > 0 && args[0] == "--json"
+	checks := doctorChecks(peonDir)
+
+	failed := false
+	for _, c := range checks {
+		if c.Status == "fail" {
+			failed = true
+		}
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(checks, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, c := range checks {
+			mark := map[string]string{"pass": "ok  ", "warn": "warn", "fail": "FAIL"}[c.Status]
+			line := fmt.Sprintf("[%s] %s", mark, c.Name)
+			if c.Detail != "" {
+				line += ": " + c.Detail
+			}
+			fmt.Println(line)
+			if c.Fix != "" && c.Status != "pass" {
+				fmt.Printf("       fix: %s\n", c.Fix)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func doctorChecks(peonDir string) []doctorCheck {
+	var checks []doctorCheck
+	add := func(name, status, detail, fix string) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+	}
+
+	// Config.
+	cfgPath := filepath.Join(peonDir, "config.json")
+	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
+		add("config", "warn", "no config.json, using defaults", "run 'peon setup' or 'peon --pack <name>' to create one")
+	}
+	cwd, _ := os.Getwd()
+	for _, l := range configLayerPaths(peonDir, cwd) {
+		data, err := os.ReadFile(l.Path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			add("config ("+l.Name+")", "fail", err.Error(), "check permissions on "+l.Path)
+			continue
+		}
+		if problems := validateConfigData(peonDir, l.Path, data); len(problems) > 0 {
+			var msgs []string
+			for _, p := range problems {
+				msgs = append(msgs, p.String())
+			}
+			add("config ("+l.Name+")", "fail", strings.Join(msgs, "; "), "run 'peon config edit' or fix "+l.Path)
+		} else {
+			add("config ("+l.Name+")", "pass", l.Path, "")
+		}
+	}
+	cfg, origin := loadConfigOrigins(peonDir, cwd)
+
+	if cfg.Enabled {
+		add("enabled", "pass", "", "")
+	} else {
+		add("enabled", "fail", "\"enabled\": false set by "+origin["enabled"], "run 'peon config show --origin' and fix that layer")
+	}
+	if openStore(peonDir).Snapshot().Paused {
+		add("paused", "warn", "sounds are paused", "run 'peon --resume'")
+	} else {
+		add("paused", "pass", "not paused", "")
+	}
+
+	// Active pack and its sounds.
+	checks = append(checks, doctorPackChecks(peonDir, cfg.ActivePack)...)
+
+	// Locks.
+	for _, name := range []string{".store.lock"} {
+		checks = append(checks, doctorLockCheck(filepath.Join(runtimeDir(peonDir), name)))
+	}
+
+	// Audio and notification backends.
+	checks = append(checks, doctorBackendChecks(peonDir)...)
+
+	// Harness registrations.
+	checks = append(checks, doctorHarnessChecks(peonDir)...)
+
+	return checks
+}
+
+func doctorPackChecks(peonDir, pack string) []doctorCheck {
+	name := "pack " + pack
+	m, err := loadManifest(peonDir, pack)
+	if err != nil {
+		return []doctorCheck{{
+			Name: name, Status: "fail",
+			Detail: "cannot load manifest: " + err.Error(),
+			Fix:    "run 'peon --packs' and switch with 'peon --pack <name>'",
+		}}
+	}
+
+	var missing, invalid []string
+	total := 0
+	seen := make(map[string]bool)
+	for _, cat := range m.Categories {
+		for _, s := range cat.Sounds {
+			total++
+			if seen[s.File] {
+				continue
+			}
+			seen[s.File] = true
+			path := soundPath(peonDir, pack, s)
+			if !fileExists(path) {
+				missing = append(missing, s.File)
+				continue
+			}
+			if _, err := readWAVInfo(path); err != nil {
+				invalid = append(invalid, s.File+" ("+err.Error()+")")
+			}
+		}
+	}
+
+	checks := []doctorCheck{{Name: name, Status: "pass", Detail: fmt.Sprintf("%d sounds in %d categories", total, len(m.Categories))}}
+	if len(missing) > 0 {
+		checks = append(checks, doctorCheck{
+			Name: name + " files", Status: "fail",
+			Detail: fmt.Sprintf("%d missing: %s", len(missing), strings.Join(missing, ", ")),
+			Fix:    "reinstall the pack or remove the entries from its manifest.json",
+		})
+	}
+	if len(invalid) > 0 {
+		checks = append(checks, doctorCheck{
+			Name: name + " files", Status: "fail",
+			Detail: fmt.Sprintf("%d not valid WAV: %s", len(invalid), strings.Join(invalid, ", ")),
+			Fix:    "re-encode the files as PCM WAV",
+		})
+	}
+	return checks
+}
+
+// doctorLockCheck tries to take a lock for up to lockTimeout. If another
+// process holds it that long, hooks give up on it and lose state updates.
+func doctorLockCheck(path string) doctorCheck {
+	name := "lock " + filepath.Base(path)
+	if !fileExists(path) && !fileExists(path+".excl") {
+		return doctorCheck{Name: name, Status: "pass", Detail: "not created yet"}
+	}
+	mode := "flock"
+	if useLockfile(filepath.Dir(path)) {
+		mode = "lockfile"
+	}
+	held, pid, err := lockHolder(path, lockTimeout)
+	switch {
+	case err != nil:
+		return doctorCheck{Name: name, Status: "fail", Detail: err.Error(), Fix: "check permissions on " + filepath.Dir(path)}
+	case held && pid > 0:
+		return doctorCheck{
+			Name: name, Status: "fail",
+			Detail: fmt.Sprintf("held by pid %d for over %s", pid, lockTimeout),
+			Fix:    fmt.Sprintf("check what pid %d is doing, or kill it", pid),
+		}
+	case held:
+		return doctorCheck{
+			Name: name, Status: "fail",
+			Detail: "held by another process for over " + lockTimeout.String(),
+			Fix:    "find it with 'fuser " + path + "' and kill it",
+		}
+	}
+	return doctorCheck{Name: name, Status: "pass", Detail: "free (" + mode + ")"}
+}
+
+func doctorBackendChecks(peonDir string) []doctorCheck {
+	var checks []doctorCheck
+	lookPath := func(bin, fix string) {
+		if p, err := exec.LookPath(bin); err == nil {
+			checks = append(checks, doctorCheck{Name: bin, Status: "pass", Detail: p})
+		} else {
+			checks = append(checks, doctorCheck{Name: bin, Status: "fail", Detail: "not found in PATH", Fix: fix})
+		}
+	}
+
+	switch detectPlatform() {
+	case "macos":
+		lookPath("afplay", "afplay ships with macOS; check your PATH")
+		lookPath("osascript", "osascript ships with macOS; check your PATH")
+	case "wsl":
+		// Where the hooks and the startup script run it from, like setup.
+		helper := filepath.Join(binDir(peonDir), "peon-helper.exe")
+		if fileExists(helper) {
+			checks = append(checks, doctorCheck{Name: "peon-helper.exe", Status: "pass", Detail: helper})
+		} else {
+			checks = append(checks, doctorCheck{
+				Name: "peon-helper.exe", Status: "fail",
+				Detail: "not found next to the peon binary (" + helper + ")",
+				Fix:    "run 'make install'",
+			})
+		}
+		lookPath("wslpath", "enable WSL interop, or update WSL")
+	default:
+		checks = append(checks, doctorCheck{
+			Name: "audio", Status: "warn",
+			Detail: "native Linux has no audio or notification backend yet",
+			Fix:    "use peon under WSL or macOS",
+		})
+	}
+	return checks
+}
+
+func doctorHarnessChecks(peonDir string) []doctorCheck {
+	var checks []doctorCheck
+	home, _ := os.UserHomeDir()
+	command := claudeHookCommand(peonDir)
+
+	// Claude Code.
+	if fileExists(filepath.Join(home, ".claude")) {
+		c := doctorCheck{Name: "Claude Code hooks", Status: "pass"}
+		path, _ := claudeSettingsPath("user")
+		s, err := readClaudeSettings(path)
+		if err != nil {
+			c.Status, c.Detail, c.Fix = "fail", err.Error(), "fix the JSON in "+path
+		} else {
+			var drift []string
+			for _, ev := range claudeHookEvents {
+				if d := s.claudeHookDrift(ev.Name, ev.Timeout, command); d != "" {
+					drift = append(drift, ev.Name+": "+d)
+				}
+			}
+			if len(drift) > 0 {
+				c.Status, c.Detail, c.Fix = "fail", strings.Join(drift, "; "), "run 'peon --install-claude'"
+			} else {
+				c.Detail = path
+			}
+		}
+		checks = append(checks, c)
+	}
+
+	// OpenCode.
+	if fileExists(filepath.Join(home, ".config", "opencode")) {
+		plugin := filepath.Join(home, ".config", "opencode", "plugins", "peon-ping.ts")
+		if data, err := os.ReadFile(plugin); err != nil {
+			checks = append(checks, doctorCheck{Name: "OpenCode plugin", Status: "fail", Detail: "not installed", Fix: "run 'peon --install-opencode'"})
+		} else if string(data) != string(opencodePlugin) {
+			checks = append(checks, doctorCheck{Name: "OpenCode plugin", Status: "warn", Detail: "differs from this peon version", Fix: "run 'peon --install-opencode'"})
+		} else {
+			checks = append(checks, doctorCheck{Name: "OpenCode plugin", Status: "pass", Detail: plugin})
+		}
+	}
+
+	// Codex.
+	if path, err := codexConfigPath(); err == nil && fileExists(filepath.Dir(path)) {
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(string(data), "\n")
+		if i := codexTopLevelNotify(lines); i >= 0 && strings.Contains(lines[i], "peon") {
+			checks = append(checks, doctorCheck{Name: "Codex notify", Status: "pass", Detail: path})
+		} else {
+			checks = append(checks, doctorCheck{Name: "Codex notify", Status: "warn", Detail: "peon is not Codex's notify program", Fix: "run 'peon setup'"})
+		}
+	}
+	return checks
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runEmit implements `peon emit`: build an Event from flags and run it
+// through the normal pipeline, so scripts, make targets, cron jobs and tools
+// like Aider's --notifications-command can fire peon events without
+// hand-building JSON.
+func runEmit(peonDir string, args []string) {
+	fs := flag.NewFlagSet("emit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, `Usage: peon emit [options]
+
+Options:
+  --type <type>        Event type (default task_complete): session_start,
+                       prompt_submit, task_complete, permission_needed,
+                       permission_request, idle, session_end
+  --project <name>     Project name (default: current directory name)
+  --message <text>     Notification / action bar message
+  --title <text>       Notification title (default: project name)
+  --session <id>       Session ID (enables action bar tracking)
+  --category <name>    Force a sound category
+  --sound <file>       Play a specific sound file
+  --urgency <level>    low, normal or critical
+  --duration <d>       Task duration shown in the notification (e.g. 2m30s)
+  --notify / --no-notify  Force the desktop notification on or off
+  --no-sound           Skip the sound, still notify
+`)
+	}
+	typ := fs.String("type", "task_complete", "")
+	project := fs.String("project", "", "")
+	message := fs.String("message", "", "")
+	title := fs.String("title", "", "")
+	session := fs.String("session", "", "")
+	category := fs.String("category", "", "")
+	sound := fs.String("sound", "", "")
+	urgency := fs.String("urgency", "", "")
+	duration := fs.Duration("duration", 0, "")
+	notify := fs.Bool("notify", false, "")
+	noNotify := fs.Bool("no-notify", false, "")
+	noSound := fs.Bool("no-sound", false, "")
+	fs.Parse(args)
+
+	if _, ok := knownEventTypes[*typ]; !ok {
+		fmt.Fprintf(os.Stderr, "peon-ping: unknown event type %q\n", *typ)
+		os.Exit(1)
+	}
+
+	cwd, _ := os.Getwd()
+	e := Event{
+		Type:      *typ,
+		CWD:       cwd,
+		SessionID: *session,
+		Message:   *message,
+		Title:     *title,
+		Project:   *project,
+		Category:  *category,
+		Sound:     *sound,
+		NoSound:   *noSound,
+		Urgency:   *urgency,
+		Duration:  *duration,
+	}
+	if *notify || *noNotify {
+		on := *notify && !*noNotify
+		e.Notify = &on
+	}
+
+	res := runEvent(peonDir, e, "", hookOptions{TTY: os.Stdout})
+	if len(res.Output) > 0 {
+		fmt.Println(string(res.Output))
+	}
+}
+
+// knownEventTypes lists the internal event types accepted from the CLI.
+var knownEventTypes = map[string]struct{}{
+	"session_start":      {},
+	"prompt_submit":      {},
+	"task_complete":      {},
+	"permission_needed":  {},
+	"permission_request": {},
+	"idle":               {},
+	"session_end":        {},
+}
@@ -1,26 +1,90 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 // Event is the internal, harness-agnostic event model.
 type Event struct {
-	Type      string // "session_start", "prompt_submit", "task_complete", "permission_needed", "idle"
+	Type      string // "session_start", "prompt_submit", "task_complete", "permission_needed", "permission_request", "idle"
 	CWD       string
 	SessionID string
 	AgentMode bool   // suppress sounds for non-interactive sessions
 	Message   string // notification message (e.g. "Claude needs your permission to use Bash")
+
+	// Optional fields from the extended generic schema (version 2+).
+	Title     string          // notification title (default: project name)
+	Project   string          // project name override (default: basename of CWD)
+	ToolName  string          // tool being run, if any
+	ToolInput json.RawMessage // tool arguments, passed through to the action bar
+	Category  string          // force a sound category
+	Sound     string          // play this file instead of picking from the category
+	NoSound   bool            // skip the sound but still notify (peon emit --no-sound)
+	Notify    *bool           // force desktop notification on/off (nil = route default)
+	Urgency   string          // "low", "normal" or "critical"
+	Duration  time.Duration   // how long the task took
 }
 
 // Route describes what to do for a given event.
 type Route struct {
-	Category    string // sound category to play (empty = no sound)
-	Status      string // tab title status text
-	Marker      string // prefix for tab title (e.g. "● ")
-	Notify      bool   // whether to send a desktop notification
-	NotifyIcon string // "permission", "complete", "idle"
-	NotifyMsg   string // notification body (project name is prepended by caller)
+	Category    string `json:"category,omitempty"`     // sound category to play (empty = no sound)
+	Status      string `json:"status,omitempty"`       // tab title status text
+	Marker      string `json:"marker,omitempty"`       // prefix for tab title (e.g. "● ")
+	Notify      bool   `json:"notify,omitempty"`       // whether to send a desktop notification
+	NotifyIcon  string `json:"notify_icon,omitempty"`  // "permission", "complete", "idle"
+	NotifyTitle string `json:"notify_title,omitempty"` // notification title (empty = project name)
+	NotifyMsg   string `json:"notify_msg,omitempty"`   // notification body (project name is prepended by caller)
 }
 
 // routeEvent maps an internal Event to a Route.
 func routeEvent(e Event) Route {
+	r := baseRoute(e)
+	ownIcon := r.NotifyIcon != ""
+
+	// Per-event overrides from the extended generic schema.
+	if e.Category != "" {
+		r.Category = e.Category
+	}
+	if e.Notify != nil {
+		r.Notify = *e.Notify
+		if r.Notify && r.NotifyIcon == "" {
+			r.NotifyIcon = "complete"
+		}
+		// An explicitly requested notification shows the event's own message.
+		if r.Notify && e.Message != "" {
+			r.NotifyMsg = e.Message
+		}
+	}
+	if r.Notify && r.NotifyMsg == "" {
+		r.NotifyMsg = e.Message
+		if r.NotifyMsg == "" {
+			r.NotifyMsg = e.Type
+		}
+	}
+	// Urgency only picks the icon (and so the color); no backend has a
+	// real urgency level. Routes with an icon of their own, like
+	// permission prompts, keep it.
+	if !ownIcon {
+		switch e.Urgency {
+		case "critical":
+			r.NotifyIcon = "permission"
+		case "normal":
+			r.NotifyIcon = "complete"
+		case "low":
+			r.NotifyIcon = "idle"
+		}
+	}
+	r.NotifyTitle = e.Title
+	if e.Duration > 0 && r.NotifyMsg != "" {
+		r.NotifyMsg = fmt.Sprintf("%s (%s)", r.NotifyMsg, formatDuration(e.Duration))
+	}
+	return r
+}
+
+// baseRoute returns the default route for an event type.
+func baseRoute(e Event) Route {
 	switch e.Type {
 	case "session_start":
 		return Route{
@@ -34,32 +98,40 @@ func routeEvent(e Event) Route {
 		}
 	case "task_complete":
 		return Route{
-			Category:    "complete",
-			Status:      "done",
-			Marker:      "● ",
-			Notify:      true,
+			Category:   "complete",
+			Status:     "done",
+			Marker:     "● ",
+			Notify:     true,
 			NotifyIcon: "complete",
-			NotifyMsg:   "Task complete",
+			NotifyMsg:  "Task complete",
 		}
-	case "permission_needed":
+	case "permission_needed", "permission_request":
 		return Route{
-			Category:    "permission",
-			Status:      "needs approval",
-			Marker:      "● ",
-			Notify:      true,
+			Category:   "permission",
+			Status:     "needs approval",
+			Marker:     "● ",
+			Notify:     true,
 			NotifyIcon: "permission",
-			NotifyMsg:   "Permission needed",
+			NotifyMsg:  "Permission needed",
 		}
 	case "idle":
 		return Route{
-			Category:    "permission",
-			Status:      "has question",
-			Marker:      "● ",
-			Notify:      true,
+			Category:   "permission",
+			Status:     "has question",
+			Marker:     "● ",
+			Notify:     true,
 			NotifyIcon: "permission",
-			NotifyMsg:   "Waiting for input",
+			NotifyMsg:  "Waiting for input",
 		}
 	default:
 		return Route{}
 	}
 }
+
+// formatDuration renders a duration compactly for notifications (e.g. "2m13s").
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
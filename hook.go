@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// hookResult summarizes what handleHook did with one event. --stream writes
+// one of these per input line when results are requested.
+type hookResult struct {
+	ID        json.RawMessage `json:"id,omitempty"` // echoed from the input line in stream mode
+	Harness   string          `json:"harness,omitempty"`
+	Event     string          `json:"event,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Category  string          `json:"category,omitempty"`
+	Sound     string          `json:"sound,omitempty"`
+	Notified  bool            `json:"notified,omitempty"`
+	Title     string          `json:"title,omitempty"`   // tab title
+	Skipped   string          `json:"skipped,omitempty"` // why nothing (more) happened
+	Output    json.RawMessage `json:"output,omitempty"`  // harness response (permission decisions)
+}
+
+// hookOptions controls the side effects of handleHook and runEvent.
+type hookOptions struct {
+	TTY     io.Writer    // receives the tab title escape sequence; nil = don't set it
+	DryRun  bool         // decide everything against a copy of the state, change nothing
+	Explain func(string) // if set, receives one line per decision and its reason
+	Log     *invocationLog // debug log record; started by handleHook or runEvent if nil
+}
+
+func (o hookOptions) explain(format string, args ...any) {
+	if o.Explain != nil {
+		o.Explain(fmt.Sprintf(format, args...))
+	}
+}
+
+// handleHook runs one raw hook payload through the full pipeline: adapter
+// detection, routing, state, sound, tab title, action bar and notification.
+//
+// Permission requests block until answered; their harness response is
+// returned in Output for the caller to print.
+func handleHook(peonDir string, input []byte, opts hookOptions) hookResult {
+	var res hookResult
+	if !opts.DryRun && opts.Log == nil {
+		opts.Log = startInvocationLog(peonDir)
+		defer opts.Log.finish()
+	}
+	defer func() { logResult(opts.Log, res) }()
+
+	// Early intercept: PermissionRequest hook gets special blocking handling.
+	var probe struct {
+		HookEventName string `json:"hook_event_name"`
+		Type          string `json:"type"`
+	}
+	json.Unmarshal(input, &probe)
+	if probe.HookEventName == "PermissionRequest" {
+		res.Harness = "claude"
+		res.Event = "permission_request"
+		opts.explain("adapter: claude (hook_event_name=PermissionRequest)")
+		if opts.DryRun {
+			opts.explain("permission: would mark the session as \"needs approval\" and wait up to 5m for an action bar answer")
+			return res
+		}
+		opts.Log.setAmbient(false) // blocks; other events may run meanwhile
+		res.Output = handlePermissionRequest(peonDir, input)
+		return res
+	}
+
+	// Detect harness and parse event.
+	endParse := opts.Log.stage("parse")
+	forceHarness := os.Getenv("PEON_HARNESS")
+	adapter := detectAdapter(json.RawMessage(input), forceHarness)
+	event, err := adapter.Parse(json.RawMessage(input))
+	endParse()
+	switch adapter.(type) {
+	case ClaudeAdapter:
+		opts.explain("adapter: claude (hook_event_name=%s)", probe.HookEventName)
+		res.Harness = "claude"
+	default:
+		opts.explain("adapter: generic")
+		res.Harness = "generic"
+	}
+	if err != nil || event.Type == "" {
+		res.Skipped = "unrecognized event"
+		if err != nil {
+			res.Skipped += ": " + err.Error()
+		}
+		opts.explain("stop: %s", res.Skipped)
+		if res.Harness == "generic" && probe.Type == "permission_request" && !opts.DryRun {
+			// The caller is waiting for a decision; let it prompt itself.
+			res.Output = askDecision()
+		}
+		return res
+	}
+
+	// Agent suppression needs the original Claude payload for permission_mode.
+	permissionMode := ""
+	if _, ok := adapter.(ClaudeAdapter); ok {
+		var cp claudePayload
+		json.Unmarshal(input, &cp)
+		permissionMode = cp.PermissionMode
+	}
+	harness := res.Harness
+	res = runEvent(peonDir, event, permissionMode, opts)
+	res.Harness = harness
+	return res
+}
+
+// runEvent is the harness-independent part of the pipeline, shared by hook
+// payloads and events built directly (peon emit). permissionMode is the
+// harness's raw permission mode, used to detect agent sessions.
+func runEvent(peonDir string, event Event, permissionMode string, opts hookOptions) (res hookResult) {
+	res = hookResult{Event: event.Type, SessionID: event.SessionID}
+	if !opts.DryRun && opts.Log == nil {
+		opts.Log = startInvocationLog(peonDir)
+		defer opts.Log.finish()
+	}
+	defer func() { logResult(opts.Log, res) }()
+	if event.Type == "permission_request" && !opts.DryRun {
+		// Every early return still owes the caller a decision.
+		defer func() {
+			if res.Output == nil {
+				res.Output = askDecision()
+			}
+		}()
+	}
+	opts.explain("event: %s (session %q, cwd %q)", event.Type, event.SessionID, event.CWD)
+
+	// Session end: remove from action bar and stop.
+	if event.Type == "session_end" {
+		opts.explain("action bar: remove session %q", event.SessionID)
+		if !opts.DryRun {
+			removeActionBarSession(peonDir, event.SessionID)
+		}
+		return res
+	}
+
+	// Load config.
+	endConfig := opts.Log.stage("config")
+	cfg := loadConfigFor(peonDir, event.CWD)
+	endConfig()
+	if !cfg.Enabled {
+		res.Skipped = "disabled in config"
+		opts.explain("stop: peon is disabled (\"enabled\": false; see peon config show --origin)")
+		return res
+	}
+	opts.explain("config: pack %q, volume %g", cfg.ActivePack, cfg.Volume)
+
+	// Open a store transaction: state, action bar and pause flag are read
+	// and written together under one lock. A dry run works on an unlocked
+	// copy instead.
+	store := openStore(peonDir)
+	var tx *StoreTx
+	if opts.DryRun {
+		tx = &StoreTx{Data: store.Snapshot()}
+	} else {
+		var err error
+		endLock := opts.Log.stage("state_lock")
+		tx, err = store.Begin()
+		endLock()
+		if err != nil {
+			// Can't lock state; play without state tracking.
+			res.Skipped = "state unavailable: " + err.Error()
+			opts.Log.addError("store.Begin", err)
+			return res
+		}
+		defer tx.Rollback()
+	}
+	st := &tx.Data.State
+	paused := tx.Data.Paused
+	saveState := func() {
+		if !opts.DryRun {
+			defer opts.Log.stage("state_save")()
+			opts.Log.addError("store.Commit", tx.Commit())
+		}
+	}
+
+	// Check agent suppression.
+	if event.AgentMode || (event.SessionID != "" && checkAgent(st, event.SessionID, permissionMode)) {
+		saveState()
+		res.Skipped = "agent session"
+		switch {
+		case event.AgentMode && permissionMode == "delegate":
+			opts.explain("suppressed: permission_mode is delegate (non-interactive agent)")
+		case event.AgentMode:
+			opts.explain("suppressed: event has agent_mode set")
+		default:
+			opts.explain("suppressed: session %s marked as delegate agent", event.SessionID)
+		}
+		return res
+	}
+
+	// Derive project name from CWD.
+	project := filepath.Base(event.CWD)
+	if event.Project != "" {
+		project = event.Project
+	}
+	if project == "" || project == "." || project == "/" {
+		project = "claude"
+	}
+	project = sanitizeProject(project)
+
+	// Session start extras.
+	if event.Type == "session_start" && !opts.DryRun {
+		// Capture the terminal window handle for popup targeting.
+		if event.SessionID != "" {
+			hwnd := captureWindowHandle()
+			if hwnd != 0 {
+				if st.WindowHandles == nil {
+					st.WindowHandles = make(map[string]uint64)
+				}
+				st.WindowHandles[event.SessionID] = hwnd
+			}
+		}
+		checkForUpdate(peonDir, tx.Data)
+		showUpdateNotice(peonDir, tx.Data)
+		if paused {
+			fmt.Fprintf(os.Stderr, "peon-ping: sounds paused — run 'peon --resume' or '/peon-ping-toggle' to unpause\n")
+		}
+	}
+
+	// Look up the saved window handle for this session, fall back to default.
+	var targetHwnd uint64
+	if st.WindowHandles != nil {
+		if event.SessionID != "" {
+			targetHwnd = st.WindowHandles[event.SessionID]
+		}
+		if targetHwnd == 0 {
+			targetHwnd = st.WindowHandles["_default"]
+		}
+	}
+
+	// Route the event.
+	route := routeEvent(event)
+	opts.explain("route: category %q, status %q, notify %v", route.Category, route.Status, route.Notify)
+
+	// Annoyed check for prompt_submit.
+	if event.Type == "prompt_submit" {
+		now := float64(time.Now().UnixMicro()) / 1e6
+		annoyed := checkAnnoyed(st, cfg.AnnoyedThreshold, cfg.AnnoyedWindowSeconds, now)
+		if catEnabled(cfg, "annoyed") {
+			if annoyed {
+				route.Category = "annoyed"
+			}
+			opts.explain("annoyed: %d prompts in the last %gs (threshold %d) → %v",
+				len(st.PromptTimestamps), cfg.AnnoyedWindowSeconds, cfg.AnnoyedThreshold, annoyed)
+		} else {
+			// Timestamps are still tracked even if the category is disabled.
+			opts.explain("annoyed: not checked, category annoyed disabled")
+		}
+	}
+
+	// Check if category is enabled.
+	if route.Category != "" && !catEnabled(cfg, route.Category) {
+		opts.explain("no sound: category %s disabled", route.Category)
+		route.Category = ""
+	}
+	res.Category = route.Category
+	opts.Log.update(func(l *invocationLog) { r := route; l.Route = &r })
+
+	// Pick sound (mutates state). An explicit sound bypasses category gating.
+	endPick := opts.Log.stage("pick")
+	var soundFile string
+	volume := cfg.Volume
+	tags := tagFilterFor(cfg, tx.Data.SafeMode)
+	if !tags.empty() {
+		opts.explain("tags: exclude %v, prefer %v (safe mode %v)", tags.Exclude, tags.Include, tx.Data.SafeMode)
+	}
+	switch {
+	case event.NoSound:
+		opts.explain("no sound: event asked for none")
+	case paused:
+		opts.explain("no sound: paused (run 'peon --resume' to unpause)")
+	case event.Sound != "":
+		soundFile = resolveSound(peonDir, cfg.ActivePack, event.Sound)
+		opts.explain("sound: explicit %q", event.Sound)
+	case route.Category != "":
+		var mult float64
+		soundFile, mult = pickSound(peonDir, cfg.ActivePack, route.Category, st, float64(time.Now().UnixMicro())/1e6, tags)
+		volume = min(cfg.Volume*mult, 1)
+		if soundFile == "" {
+			opts.explain("no sound: pack %q has no playable sounds for category %s (none listed, all within min_interval, or all excluded by tags)", cfg.ActivePack, route.Category)
+		}
+	default:
+		opts.explain("no sound: event has no category")
+	}
+	if soundFile != "" && !fileExists(soundFile) {
+		opts.explain("no sound: %s does not exist", soundFile)
+		logError("pickSound", fmt.Errorf("%s does not exist", soundFile))
+	}
+	endPick()
+
+	// Update action bar state, in the same transaction.
+	// Skip for permission events — handlePermissionRequest and
+	// handleGenericPermission are the single source of truth for
+	// "needs approval" state (avoids dual-write race).
+	abWrite := "none"
+	if event.SessionID != "" && route.Status != "" && event.Type != "permission_needed" && event.Type != "permission_request" {
+		abWrite = fmt.Sprintf("session %s → %q (project %q)", event.SessionID, route.Status, project)
+		tx.Data.ActionBar.setSession(event.SessionID, project, route.Status, event.Message, targetHwnd)
+	}
+
+	// Commit state and action bar, releasing the lock.
+	saveState()
+
+	// Set tab title. Not for permission_request: its decision goes to
+	// stdout, and a caller parsing that as JSON would choke on the escape.
+	if route.Status != "" {
+		res.Title = fmt.Sprintf("%s%s: %s", route.Marker, project, route.Status)
+		if opts.TTY != nil && !opts.DryRun && event.Type != "permission_request" {
+			fmt.Fprintf(opts.TTY, "\033]0;%s\007", res.Title)
+		}
+	}
+
+	// Play sound and/or notify.
+	notifyTitle := project
+	if route.NotifyTitle != "" {
+		notifyTitle = route.NotifyTitle
+	}
+	if paused {
+		res.Skipped = "paused"
+	} else {
+		if soundFile != "" && fileExists(soundFile) {
+			res.Sound = soundFile
+		}
+		res.Notified = route.Notify
+		if !opts.DryRun {
+			endBackend := opts.Log.stage("backend")
+			if res.Sound != "" && route.Notify {
+				playSoundAndNotify(soundFile, volume, notifyTitle, route.NotifyMsg, route.NotifyIcon, targetHwnd)
+			} else if res.Sound != "" {
+				playSound(soundFile, volume)
+			} else if route.Notify {
+				sendNotification(notifyTitle, route.NotifyMsg, route.NotifyIcon, targetHwnd)
+			}
+			endBackend()
+		}
+	}
+
+	if opts.Explain != nil {
+		opts.explain("──")
+		opts.explain("sound:        %s", orNone(res.Sound, fmt.Sprintf(" (volume %g)", volume)))
+		if res.Notified {
+			opts.explain("notification: %q — %q [%s]", notifyTitle, route.NotifyMsg, route.NotifyIcon)
+		} else {
+			opts.explain("notification: none")
+		}
+		opts.explain("tab title:    %s", orNone(res.Title, ""))
+		opts.explain("action bar:   %s", abWrite)
+	}
+
+	// Generic permission requests block until answered in the action bar.
+	if event.Type == "permission_request" {
+		if opts.DryRun {
+			opts.explain("permission:   would wait up to 5m for an action bar answer, then print the decision")
+		} else {
+			opts.Log.setAmbient(false) // blocks; other events may run meanwhile
+			res.Output = handleGenericPermission(peonDir, event, project, targetHwnd)
+		}
+	}
+
+	return res
+}
+
+// logResult copies the outcome of an invocation into its debug log record.
+func logResult(log *invocationLog, res hookResult) {
+	log.update(func(l *invocationLog) {
+		l.Harness = res.Harness
+		l.Event = res.Event
+		l.Session = res.SessionID
+		l.Sound = res.Sound
+		l.Skipped = res.Skipped
+	})
+}
+
+// orNone returns s followed by suffix, or "none" if s is empty.
+func orNone(s, suffix string) string {
+	if s == "" {
+		return "none"
+	}
+	return s + suffix
+}
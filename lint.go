@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMaxSoundDuration is the lint limit for a single sound. Hook sounds
+// play over the user's work; anything longer gets in the way.
+const defaultMaxSoundDuration = 10 * time.Second
+
+// lintIssue is one finding from peon pack lint.
+type lintIssue struct {
+	configProblem
+	Warning bool
+}
+
+func (i lintIssue) String() string {
+	p := i.configProblem
+	if i.Warning {
+		p.Msg = "warning: " + p.Msg
+	} else {
+		p.Msg = "error: " + p.Msg
+	}
+	return p.String()
+}
+
+// packLinter collects issues for one pack directory.
+type packLinter struct {
+	peonDir     string // for resolving extends
+	dir         string
+	maxDuration time.Duration
+	issues      []lintIssue
+}
+
+func (l *packLinter) add(warn bool, path string, format string, args ...any) {
+	l.issues = append(l.issues, lintIssue{configProblem{Path: path, Msg: fmt.Sprintf(format, args...)}, warn})
+}
+
+// lintPackCmd implements `peon pack lint <name|path> [--max-duration 10s]
+// [--strict]`. It returns errPackFailed on errors, or on warnings too with
+// --strict, so the command exits 1.
+func lintPackCmd(peonDir string, args []string) error {
+	maxDur := defaultMaxSoundDuration
+	strict := false
+	var targets []string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; a {
+		case "--strict":
+			strict = true
+		case "--max-duration":
+			if i+1 >= len(args) {
+				return errors.New("--max-duration needs a value like 5s")
+			}
+			i++
+			d, err := time.ParseDuration(args[i])
+			if err != nil {
+				return fmt.Errorf("--max-duration: %w", err)
+			}
+			maxDur = d
+		default:
+			targets = append(targets, a)
+		}
+	}
+	if len(targets) == 0 {
+		return errors.New("usage: peon pack lint <name|path>... [--max-duration 10s] [--strict]")
+	}
+
+	var errs, warns int
+	for _, t := range targets {
+		dir := t
+		if isRegistryName(t) {
+			if d, err := installedPackDir(peonDir, t); err == nil {
+				dir = d
+			}
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not an installed pack or a pack directory", t)
+		}
+		l := &packLinter{peonDir: peonDir, dir: dir, maxDuration: maxDur}
+		l.lint()
+		for _, i := range l.issues {
+			fmt.Println(i)
+			if i.Warning {
+				warns++
+			} else {
+				errs++
+			}
+		}
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", errs, warns)
+	if errs > 0 || (strict && warns > 0) {
+		return errPackFailed
+	}
+	return nil
+}
+
+// lint runs every check on the pack.
+func (l *packLinter) lint() {
+	mpath := filepath.Join(l.dir, "manifest.json")
+	data, err := os.ReadFile(mpath)
+	if err != nil {
+		l.add(false, mpath, "%v", err)
+		return
+	}
+	m, ok := l.decodeManifest(mpath, data)
+	if !ok {
+		return
+	}
+
+	if m.DisplayName == "" {
+		l.add(true, mpath, "display_name is missing")
+	}
+	if base := filepath.Base(l.dir); m.Name != "" && m.Name != base && !strings.HasPrefix(base, ".") {
+		l.add(true, mpath, "name %q doesn't match the directory name %q", m.Name, base)
+	}
+	switch {
+	case m.Extends != "":
+		if _, err := loadManifest(l.peonDir, m.Extends); err != nil {
+			l.add(true, mpath, "extends %q, which can't be loaded: %v", m.Extends, err)
+		}
+	case len(m.Categories) == 0:
+		l.add(false, mpath, "no categories")
+	}
+
+	known := knownCategories()
+	soundsDir := filepath.Join(l.dir, "sounds")
+	referenced := make(map[string]bool)
+	formats := make(map[[2]uint32][]string) // sample rate, channels → files
+	cats := make([]string, 0, len(m.Categories))
+	for c := range m.Categories {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for _, cat := range cats {
+		sounds := m.Categories[cat].Sounds
+		if !slices.Contains(known, cat) {
+			l.add(false, mpath, "unknown category %q; it will never play (known: %s)", cat, strings.Join(known, ", "))
+		}
+		if len(sounds) == 0 && m.Extends == "" {
+			l.add(true, mpath, "category %q has no sounds", cat)
+		}
+		seen := make(map[string]bool)
+		for _, s := range sounds {
+			if s.File == "" {
+				l.add(false, mpath, "category %q: sound with no file", cat)
+				continue
+			}
+			if seen[s.File] {
+				l.add(false, mpath, "category %q lists %s more than once", cat, s.File)
+				continue
+			}
+			seen[s.File] = true
+			l.checkSoundValues(mpath, cat, s)
+			path, err := safeJoin(soundsDir, s.File)
+			if err != nil {
+				l.add(false, mpath, "category %q: %s is outside sounds/", cat, s.File)
+				continue
+			}
+			if referenced[path] {
+				continue // checked already, from another category
+			}
+			referenced[path] = true
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				l.add(false, mpath, "category %q: sounds/%s does not exist", cat, s.File)
+				continue
+			}
+			w, err := readWAVInfo(path)
+			if err != nil {
+				l.add(false, path, "%v", err)
+				continue
+			}
+			if d := w.Duration(); d > l.maxDuration {
+				l.add(true, path, "%.1fs long (limit %s)", d.Seconds(), l.maxDuration)
+			}
+			key := [2]uint32{w.SampleRate, uint32(w.Channels)}
+			formats[key] = append(formats[key], s.File)
+		}
+	}
+
+	l.checkFormats(soundsDir, formats)
+	l.checkUnreferenced(soundsDir, referenced)
+
+	// An installed pack's packs.d overlay is checked along with it.
+	if name := filepath.Base(l.dir); filepath.Dir(filepath.Clean(l.dir)) == packsDir(l.peonDir) {
+		if ov := overlayDir(l.peonDir, name); fileExists(filepath.Join(ov, "manifest.json")) {
+			l.lintOverlay(ov, m)
+		}
+	}
+}
+
+// checkSoundValues checks a sound's weight, volume and min_interval.
+func (l *packLinter) checkSoundValues(mpath, cat string, s ManifestSound) {
+	if s.Weight != nil && *s.Weight < 0 {
+		l.add(false, mpath, "category %q: %s has negative weight", cat, s.File)
+	}
+	if s.Volume != nil && (*s.Volume < 0 || *s.Volume > 4) {
+		l.add(false, mpath, "category %q: %s volume must be between 0 and 4, got %g", cat, s.File, *s.Volume)
+	}
+	if s.MinInterval < 0 {
+		l.add(false, mpath, "category %q: %s has negative min_interval", cat, s.File)
+	}
+}
+
+// lintOverlay checks a packs.d overlay against the pack it applies to. An
+// entry's file must be in the overlay's sounds/ or already in the pack.
+func (l *packLinter) lintOverlay(dir string, pack Manifest) {
+	mpath := filepath.Join(dir, "manifest.json")
+	data, err := os.ReadFile(mpath)
+	if err != nil {
+		l.add(false, mpath, "%v", err)
+		return
+	}
+	m, ok := l.decodeManifest(mpath, data)
+	if !ok {
+		return
+	}
+	if m.Name != "" || m.Extends != "" {
+		l.add(true, mpath, "name and extends are ignored in an overlay")
+	}
+
+	// What the pack lists per category, inherited categories included, and
+	// where each file lives.
+	base := maps.Clone(pack.Categories)
+	for _, s := range base {
+		for i := range s.Sounds {
+			s.Sounds[i].dir = filepath.Join(l.dir, "sounds")
+		}
+	}
+	if pack.Extends != "" {
+		if parent, err := loadManifest(l.peonDir, pack.Extends); err == nil {
+			for c, pc := range parent.Categories {
+				if _, ok := base[c]; !ok {
+					base[c] = pc
+				}
+			}
+		}
+	}
+
+	known := knownCategories()
+	soundsDir := filepath.Join(dir, "sounds")
+	referenced := make(map[string]bool)
+	cats := make([]string, 0, len(m.Categories))
+	for c := range m.Categories {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for _, cat := range cats {
+		c := m.Categories[cat]
+		if !slices.Contains(known, cat) {
+			l.add(false, mpath, "unknown category %q; it will never play (known: %s)", cat, strings.Join(known, ", "))
+		}
+		if c.Disabled {
+			continue
+		}
+		for _, s := range c.Sounds {
+			if s.File == "" {
+				l.add(false, mpath, "category %q: sound with no file", cat)
+				continue
+			}
+			path, err := safeJoin(soundsDir, s.File)
+			if err != nil {
+				l.add(false, mpath, "category %q: %s is outside sounds/", cat, s.File)
+				continue
+			}
+			if s.Disabled {
+				if indexSound(base[cat].Sounds, s.File) < 0 {
+					l.add(true, mpath, "category %q: disables %s, which the pack doesn't list there", cat, s.File)
+				}
+				continue
+			}
+			l.checkSoundValues(mpath, cat, s)
+			if !fileExists(path) {
+				// As in applyOverlay: the entry re-describes the pack's own
+				// sound, or names a file in the pack's sounds/.
+				i := indexSound(base[cat].Sounds, s.File)
+				inPack := i >= 0 && fileExists(soundPath(l.peonDir, "", base[cat].Sounds[i]))
+				if p, err := safeJoin(filepath.Join(l.dir, "sounds"), s.File); err == nil && fileExists(p) {
+					inPack = true
+				}
+				if !inPack {
+					l.add(false, mpath, "category %q: %s is in neither the overlay's nor the pack's sounds", cat, s.File)
+				}
+				continue
+			}
+			if referenced[path] {
+				continue
+			}
+			referenced[path] = true
+			w, err := readWAVInfo(path)
+			if err != nil {
+				l.add(false, path, "%v", err)
+			} else if d := w.Duration(); d > l.maxDuration {
+				l.add(true, path, "%.1fs long (limit %s)", d.Seconds(), l.maxDuration)
+			}
+		}
+	}
+	l.checkUnreferenced(soundsDir, referenced)
+}
+
+// decodeManifest parses manifest.json strictly: no syntax errors, no
+// unknown keys, no wrong types, nothing after the object.
+func (l *packLinter) decodeManifest(path string, data []byte) (Manifest, bool) {
+	var m Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&m)
+	if err == nil {
+		if _, terr := dec.Token(); terr != io.EOF {
+			err = errors.New("unexpected data after the manifest object")
+		}
+	}
+	if err == nil {
+		return m, true
+	}
+	p := configProblem{Path: path, Msg: strings.TrimPrefix(err.Error(), "json: ")}
+	var syn *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syn):
+		p.Line, p.Col = lineCol(data, max(syn.Offset-1, 0))
+	case errors.As(err, &typ):
+		p.Line, p.Col = lineCol(data, typ.Offset)
+		p.Msg = fmt.Sprintf("%s must be %s, not %s", typ.Field, jsonTypeName(typ.Type), typ.Value)
+	default:
+		// Unknown fields and trailing data: the decoder has stopped just
+		// after the problem.
+		p.Line, p.Col = lineCol(data, dec.InputOffset())
+	}
+	l.issues = append(l.issues, lintIssue{configProblem: p})
+	return m, false
+}
+
+// checkFormats warns about sounds whose sample rate or channel count differs
+// from the rest of the pack; mixed formats make volume and quality uneven.
+func (l *packLinter) checkFormats(soundsDir string, formats map[[2]uint32][]string) {
+	if len(formats) < 2 {
+		return
+	}
+	var common [2]uint32
+	detail := make(map[string][2]uint32)
+	for k, files := range formats {
+		if len(files) > len(formats[common]) || (len(files) == len(formats[common]) && (k[0] > common[0] || k[0] == common[0] && k[1] > common[1])) {
+			common = k
+		}
+	}
+	var odd []string
+	for k, files := range formats {
+		if k == common {
+			continue
+		}
+		for _, f := range files {
+			odd = append(odd, f)
+			detail[f] = k
+		}
+	}
+	sort.Strings(odd)
+	for _, f := range odd {
+		k := detail[f]
+		l.add(true, filepath.Join(soundsDir, f), "%d Hz, %d channel(s); most of the pack is %d Hz, %d channel(s)", k[0], k[1], common[0], common[1])
+	}
+}
+
+// checkUnreferenced warns about files in sounds/ that no category lists.
+func (l *packLinter) checkUnreferenced(soundsDir string, referenced map[string]bool) {
+	var extra []string
+	filepath.WalkDir(soundsDir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !referenced[p] {
+			extra = append(extra, p)
+		}
+		return nil
+	})
+	for _, p := range extra {
+		l.add(true, p, "not listed in manifest.json")
+	}
+}
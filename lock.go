@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockTimeout bounds how long a hook waits for a lock. It is well under the
+// harness hook timeout so a wedged process degrades one event instead of
+// hanging every hook behind it.
+const lockTimeout = 2 * time.Second
+
+// staleLockAge is how old an O_EXCL lockfile must be before it is broken even
+// if its PID is alive, in case the PID has since been reused.
+const staleLockAge = 30 * time.Second
+
+// fileLock is an exclusive inter-process lock. It uses flock on path where
+// that works, and otherwise an O_EXCL lockfile at path+".excl" that holds the
+// owner's PID and a nonce. flock mode records the PID in path too, so a
+// timed-out waiter can say who is holding it.
+type fileLock struct {
+	path  string
+	f     *os.File // flock mode
+	excl  bool     // lockfile mode
+	token string   // lockfile contents, so Unlock only removes its own
+}
+
+// lockError is returned when a lock can't be acquired in time.
+type lockError struct {
+	Path   string
+	PID    int // holder, 0 if unknown
+	Waited time.Duration
+}
+
+func (e *lockError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("%s held by pid %d for over %s", filepath.Base(e.Path), e.PID, e.Waited.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s held for over %s", filepath.Base(e.Path), e.Waited.Round(time.Millisecond))
+}
+
+// lockWait is a debug log record of a contended or broken lock.
+type lockWait struct {
+	Lock     string  `json:"lock"`
+	Mode     string  `json:"mode"`
+	WaitedMS float64 `json:"waited_ms"`
+	Holder   int     `json:"holder,omitempty"`
+	Result   string  `json:"result"` // acquired, timeout or broke_stale
+}
+
+// useLockfile reports whether to skip flock for a directory: on request via
+// PEON_LOCK=file, or on WSL when the dir is on a Windows drive (/mnt/c),
+// where flock isn't reliable.
+func useLockfile(dir string) bool {
+	switch os.Getenv("PEON_LOCK") {
+	case "file":
+		return true
+	case "flock":
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	return err == nil && strings.HasPrefix(abs, "/mnt/") && detectPlatform() == "wsl"
+}
+
+// acquireLock takes an exclusive lock on path, waiting up to timeout.
+func acquireLock(path string, timeout time.Duration) (*fileLock, error) {
+	if !useLockfile(filepath.Dir(path)) {
+		l, err := acquireFlock(path, timeout)
+		if !errors.Is(err, syscall.ENOTSUP) && !errors.Is(err, syscall.ENOLCK) && !errors.Is(err, syscall.EINVAL) {
+			return l, err
+		}
+		// flock isn't supported on this filesystem; fall back.
+	}
+	return acquireLockfile(path, timeout)
+}
+
+func acquireFlock(path string, timeout time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	for delay := time.Millisecond; ; delay = min(delay*2, 50*time.Millisecond) {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+		if time.Since(start) >= timeout {
+			holder := readLockPID(path)
+			f.Close()
+			logLockWait(path, "flock", start, holder, "timeout")
+			return nil, &lockError{Path: path, PID: holder, Waited: time.Since(start)}
+		}
+		time.Sleep(delay)
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		logLockWait(path, "flock", start, 0, "acquired")
+	}
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return &fileLock{path: path, f: f}, nil
+}
+
+func acquireLockfile(path string, timeout time.Duration) (*fileLock, error) {
+	lockfile := path + ".excl"
+	start := time.Now()
+	contended := false
+	for delay := time.Millisecond; ; delay = min(delay*2, 50*time.Millisecond) {
+		f, err := os.OpenFile(lockfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			token := fmt.Sprintf("%d %d", os.Getpid(), time.Now().UnixNano())
+			f.WriteString(token)
+			f.Close()
+			if contended {
+				logLockWait(path, "lockfile", start, 0, "acquired")
+			}
+			return &fileLock{path: path, excl: true, token: token}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		contended = true
+
+		holder := readLockPID(lockfile)
+		if info, err := os.Stat(lockfile); err == nil && lockfileStale(info, holder) {
+			if breakStaleLock(lockfile, info) {
+				logLockWait(path, "lockfile", start, holder, "broke_stale")
+			}
+			continue
+		}
+		if time.Since(start) >= timeout {
+			logLockWait(path, "lockfile", start, holder, "timeout")
+			return nil, &lockError{Path: path, PID: holder, Waited: time.Since(start)}
+		}
+		time.Sleep(delay)
+	}
+}
+
+// lockfileStale reports whether a lockfile's owner is gone: its PID no longer
+// exists, or the file is older than staleLockAge.
+func lockfileStale(info os.FileInfo, pid int) bool {
+	if time.Since(info.ModTime()) > staleLockAge {
+		return true
+	}
+	if pid <= 0 {
+		// Being written right now, or garbage; give it a moment.
+		return time.Since(info.ModTime()) > time.Second
+	}
+	return !processAlive(pid)
+}
+
+// breakStaleLock removes a lockfile judged stale, if it is still the same
+// file. Removing by name could delete a fresh lock another waiter created
+// after breaking the stale one, so the file is first renamed aside and
+// compared with what was judged; a live lock grabbed by mistake goes back.
+func breakStaleLock(lockfile string, stale os.FileInfo) bool {
+	aside := fmt.Sprintf("%s.stale-%d-%d", lockfile, os.Getpid(), time.Now().UnixNano())
+	if os.Rename(lockfile, aside) != nil {
+		return false // someone else broke or released it
+	}
+	info, err := os.Stat(aside)
+	if err == nil && !os.SameFile(info, stale) {
+		// Link fails if yet another lockfile appeared meanwhile; that one
+		// is live, and so is its owner's claim.
+		os.Link(aside, lockfile)
+		os.Remove(aside)
+		return false
+	}
+	os.Remove(aside)
+	return true
+}
+
+// processAlive reports whether pid exists. EPERM means it exists but belongs
+// to someone else.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// readLockPID returns the PID recorded in a lock file, or 0.
+func readLockPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	pid, _ := strconv.Atoi(fields[0])
+	return pid
+}
+
+// Unlock releases the lock. A lockfile is only removed if it is still ours;
+// if it was broken as stale meanwhile, it belongs to someone else now.
+func (l *fileLock) Unlock() error {
+	if l.excl {
+		lockfile := l.path + ".excl"
+		data, err := os.ReadFile(lockfile)
+		if err != nil || string(data) != l.token {
+			return fmt.Errorf("%s: lock was broken while held", filepath.Base(lockfile))
+		}
+		return os.Remove(lockfile)
+	}
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
+
+// lockHolder reports whether the lock at path is currently held and by whom,
+// without taking it for longer than a moment. Used by peon doctor.
+func lockHolder(path string, wait time.Duration) (held bool, pid int, err error) {
+	l, err := acquireLock(path, wait)
+	var le *lockError
+	if errors.As(err, &le) {
+		return true, le.PID, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return false, 0, l.Unlock()
+}
+
+func logLockWait(path, mode string, start time.Time, holder int, result string) {
+	logUpdate(func(l *invocationLog) {
+		l.Locks = append(l.Locks, lockWait{
+			Lock:     filepath.Base(path),
+			Mode:     mode,
+			WaitedMS: msSince(start),
+			Holder:   holder,
+			Result:   result,
+		})
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -34,12 +33,13 @@ type hookDecision struct {
 
 // handlePermissionRequest handles PermissionRequest hook events by updating
 // the action bar state and polling for a response file written by the action
-// bar helper. Falls back to terminal dialog on timeout.
+// bar helper. Returns the hook output for Claude Code, or nil on timeout so
+// Claude falls back to its terminal dialog.
 //
 // This is the single source of truth for "needs approval" state — the
 // Notification(permission_prompt) hook deliberately skips action bar writes
 // to avoid racing with this handler.
-func handlePermissionRequest(peonDir string, raw []byte) {
+func handlePermissionRequest(peonDir string, raw []byte) json.RawMessage {
 	var payload struct {
 		SessionID             string          `json:"session_id"`
 		ToolName              string          `json:"tool_name"`
@@ -47,79 +47,105 @@ func handlePermissionRequest(peonDir string, raw []byte) {
 		PermissionSuggestions json.RawMessage `json:"permission_suggestions"`
 	}
 	if err := json.Unmarshal(raw, &payload); err != nil || payload.SessionID == "" {
-		os.Exit(0)
+		return nil
+	}
+
+	rsp, ok := awaitPermissionResponse(peonDir, payload.SessionID, payload.ToolName, payload.ToolInput, payload.PermissionSuggestions)
+	if !ok {
+		return nil
+	}
+
+	// Build the hook response.
+	decision := hookDecision{
+		Behavior: rsp.Behavior,
+	}
+	if rsp.ApplySuggestions && len(payload.PermissionSuggestions) > 0 {
+		decision.UpdatedPermissions = payload.PermissionSuggestions
 	}
 
-	rspPath := filepath.Join(peonDir, ".actionbar-rsp-"+payload.SessionID+".json")
-	heartbeatPath := filepath.Join(peonDir, ".actionbar-hb-"+payload.SessionID)
+	out := hookOutput{
+		HookSpecificOutput: hookSpecificOutput{
+			HookEventName: "PermissionRequest",
+			Decision:      decision,
+		},
+	}
+	outData, _ := json.Marshal(out)
+	return outData
+}
+
+// genericPermissionOutput is the harness-neutral decision printed on stdout
+// for generic permission_request events.
+type genericPermissionOutput struct {
+	Decision         string `json:"decision"` // "allow", "deny" or "ask" (unanswered; use the harness's own prompt)
+	ApplySuggestions bool   `json:"apply_suggestions,omitempty"`
+}
+
+// askDecision is the generic permission output when peon has no answer: the
+// harness should fall back to its own prompt.
+func askDecision() json.RawMessage {
+	out, _ := json.Marshal(genericPermissionOutput{Decision: "ask"})
+	return out
+}
+
+// handleGenericPermission blocks on the action bar for a permission_request
+// event from a generic harness and returns the decision as JSON.
+func handleGenericPermission(peonDir string, e Event, project string, hwnd uint64) json.RawMessage {
+	out := genericPermissionOutput{Decision: "ask"}
+	if e.SessionID != "" {
+		ensureActionBarSession(peonDir, e.SessionID, project, hwnd)
+		if rsp, ok := awaitPermissionResponse(peonDir, e.SessionID, e.ToolName, e.ToolInput, nil); ok {
+			out.Decision = rsp.Behavior
+			out.ApplySuggestions = rsp.ApplySuggestions
+		}
+	}
+	outData, _ := json.Marshal(out)
+	return outData
+}
+
+// awaitPermissionResponse marks the session as "needs approval" in the action
+// bar and polls the store's permission mailbox for the helper's response.
+// Returns false on timeout.
+func awaitPermissionResponse(peonDir, sessionID, toolName string, toolInput, permSuggestions json.RawMessage) (permissionRspFile, bool) {
+	store := openStore(peonDir)
 
-	// Clean up any stale response file.
-	os.Remove(rspPath)
+	// Clean up any stale response.
+	store.ClearPermissionResponse(sessionID)
 
 	// Update action bar state with "needs approval" + tool details (single source of truth).
-	updateActionBarPermission(peonDir, payload.SessionID, payload.ToolName, payload.ToolInput, payload.PermissionSuggestions)
+	updateActionBarPermission(peonDir, sessionID, toolName, toolInput, permSuggestions)
 
-	// Create heartbeat file so the helper knows we're alive and polling.
+	// Start the heartbeat so the helper knows we're alive and polling.
 	// Note: os.Exit and process kills don't run defers, so the helper
 	// uses the heartbeat staleness to detect in-terminal handling.
-	os.WriteFile(heartbeatPath, nil, 0644)
+	store.Heartbeat(sessionID)
 
-	// Poll for response file (500ms intervals, up to 5 minutes).
+	// Poll for a response (500ms intervals, up to 5 minutes).
 	deadline := time.Now().Add(5 * time.Minute)
 	for time.Now().Before(deadline) {
 		time.Sleep(500 * time.Millisecond)
+		store.Heartbeat(sessionID)
 
-		// Touch heartbeat so the helper knows we're still alive.
-		now := time.Now()
-		os.Chtimes(heartbeatPath, now, now)
-
-		rspData, err := os.ReadFile(rspPath)
-		if err != nil {
+		rsp, ok := store.PermissionResponse(sessionID)
+		if !ok {
 			continue // not yet written
 		}
 
-		var rsp permissionRspFile
-		if err := json.Unmarshal(rspData, &rsp); err != nil {
-			continue
-		}
-
-		// Clean up response + heartbeat files and update action bar to "working".
-		os.Remove(rspPath)
-		os.Remove(heartbeatPath)
-		clearActionBarPermission(peonDir, payload.SessionID)
-
-		// Build and output the hook response.
-		decision := hookDecision{
-			Behavior: rsp.Behavior,
-		}
-		if rsp.ApplySuggestions && len(payload.PermissionSuggestions) > 0 {
-			decision.UpdatedPermissions = payload.PermissionSuggestions
-		}
-
-		out := hookOutput{
-			HookSpecificOutput: hookSpecificOutput{
-				HookEventName: "PermissionRequest",
-				Decision:      decision,
-			},
-		}
-		outData, _ := json.Marshal(out)
-		fmt.Println(string(outData))
-		os.Exit(0)
+		// Clean up and update action bar to "working".
+		store.ClearPermissionResponse(sessionID)
+		store.EndHeartbeat(sessionID)
+		clearActionBarPermission(peonDir, sessionID)
+		return rsp, true
 	}
 
-	// Timeout: clean up heartbeat and fall through to terminal dialog.
-	os.Remove(heartbeatPath)
-	os.Exit(0)
+	// Timeout: stop the heartbeat.
+	store.EndHeartbeat(sessionID)
+	return permissionRspFile{}, false
 }
 
 const version = "2.0.0"
 
 func main() {
-	peonDir := os.Getenv("CLAUDE_PEON_DIR")
-	if peonDir == "" {
-		home, _ := os.UserHomeDir()
-		peonDir = filepath.Join(home, ".claude", "hooks", "peon-ping")
-	}
+	peonDir := defaultPeonDir()
 
 	// CLI subcommands (must come before stdin read which would block).
 	if len(os.Args) > 1 {
@@ -133,151 +159,11 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Early intercept: PermissionRequest hook gets special blocking handling.
-	var probe struct {
-		HookEventName string `json:"hook_event_name"`
-	}
-	json.Unmarshal(input, &probe)
-	if probe.HookEventName == "PermissionRequest" {
-		handlePermissionRequest(peonDir, input)
-		// handlePermissionRequest always calls os.Exit; this is unreachable.
-	}
-
-	// Detect harness and parse event.
-	forceHarness := os.Getenv("PEON_HARNESS")
-	adapter := detectAdapter(json.RawMessage(input), forceHarness)
-	event, err := adapter.Parse(json.RawMessage(input))
-	if err != nil || event.Type == "" {
-		os.Exit(0)
+	res := handleHook(peonDir, input, hookOptions{TTY: os.Stdout})
+	if len(res.Output) > 0 {
+		fmt.Println(string(res.Output))
 	}
-
-	// Session end: remove from action bar and exit.
-	if event.Type == "session_end" {
-		removeActionBarSession(peonDir, event.SessionID)
-		os.Exit(0)
-	}
-
-	// Load config.
-	cfg := loadConfig(peonDir)
-	if !cfg.Enabled {
-		os.Exit(0)
-	}
-
-	// Check paused.
-	pausedFile := filepath.Join(peonDir, ".paused")
-	paused := fileExists(pausedFile)
-
-	// Load state with flock.
-	ls, err := loadStateLocked(peonDir)
-	if err != nil {
-		// Can't lock state; play without state tracking.
-		os.Exit(0)
-	}
-
-	// Check agent suppression (needs original Claude payload for permission_mode).
-	permissionMode := ""
-	if _, ok := adapter.(ClaudeAdapter); ok {
-		var cp claudePayload
-		json.Unmarshal(input, &cp)
-		permissionMode = cp.PermissionMode
-	}
-	if event.AgentMode || (event.SessionID != "" && checkAgent(ls.State, event.SessionID, permissionMode)) {
-		ls.saveStateUnlock(peonDir)
-		os.Exit(0)
-	}
-
-	// Derive project name from CWD.
-	project := filepath.Base(event.CWD)
-	if project == "" || project == "." || project == "/" {
-		project = "claude"
-	}
-	project = sanitizeProject(project)
-
-	// Session start extras.
-	if event.Type == "session_start" {
-		// Capture the terminal window handle for popup targeting.
-		if event.SessionID != "" {
-			hwnd := captureWindowHandle()
-			if hwnd != 0 {
-				if ls.State.WindowHandles == nil {
-					ls.State.WindowHandles = make(map[string]uint64)
-				}
-				ls.State.WindowHandles[event.SessionID] = hwnd
-			}
-		}
-		checkForUpdate(peonDir)
-		showUpdateNotice(peonDir)
-		if paused {
-			fmt.Fprintf(os.Stderr, "peon-ping: sounds paused — run 'peon --resume' or '/peon-ping-toggle' to unpause\n")
-		}
-	}
-
-	// Look up the saved window handle for this session, fall back to default.
-	var targetHwnd uint64
-	if ls.State.WindowHandles != nil {
-		if event.SessionID != "" {
-			targetHwnd = ls.State.WindowHandles[event.SessionID]
-		}
-		if targetHwnd == 0 {
-			targetHwnd = ls.State.WindowHandles["_default"]
-		}
-	}
-
-	// Route the event.
-	route := routeEvent(event)
-
-	// Annoyed check for prompt_submit.
-	if event.Type == "prompt_submit" {
-		if catEnabled(cfg, "annoyed") {
-			now := float64(time.Now().UnixMicro()) / 1e6
-			if checkAnnoyed(ls.State, cfg.AnnoyedThreshold, cfg.AnnoyedWindowSeconds, now) {
-				route.Category = "annoyed"
-			}
-		} else {
-			// Still track timestamps even if category disabled.
-			now := float64(time.Now().UnixMicro()) / 1e6
-			checkAnnoyed(ls.State, cfg.AnnoyedThreshold, cfg.AnnoyedWindowSeconds, now)
-		}
-	}
-
-	// Check if category is enabled.
-	if route.Category != "" && !catEnabled(cfg, route.Category) {
-		route.Category = ""
-	}
-
-	// Pick sound (mutates state).
-	var soundFile string
-	if route.Category != "" && !paused {
-		soundFile = pickSound(peonDir, cfg.ActivePack, route.Category, ls.State)
-	}
-
-	// Save state and release lock.
-	ls.saveStateUnlock(peonDir)
-
-	// Set tab title.
-	if route.Status != "" {
-		title := fmt.Sprintf("%s%s: %s", route.Marker, project, route.Status)
-		fmt.Printf("\033]0;%s\007", title)
-	}
-
-	// Update action bar state.
-	// Skip for permission_needed — handlePermissionRequest is the single source
-	// of truth for "needs approval" state (avoids dual-write race).
-	if event.SessionID != "" && route.Status != "" && event.Type != "permission_needed" {
-		writeActionBarSession(peonDir, event.SessionID, project, route.Status, event.Message, targetHwnd)
-	}
-
-	// Play sound and/or notify.
-	if !paused {
-		if soundFile != "" && fileExists(soundFile) && route.Notify {
-			playSoundAndNotify(soundFile, cfg.Volume, project, route.NotifyMsg, route.NotifyIcon, targetHwnd)
-		} else if soundFile != "" && fileExists(soundFile) {
-			playSound(soundFile, cfg.Volume)
-		} else if route.Notify {
-			sendNotification(project, route.NotifyMsg, route.NotifyIcon, targetHwnd)
-		}
-	}
-
+	recordHook(peonDir, input, res)
 	os.Exit(0)
 }
 
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// migration upgrades a decoded file from one version to the next, in place.
+type migration func(m map[string]json.RawMessage) error
+
+// configMigrations[i] upgrades config files from version i to i+1. Append to
+// add a version; configVersion follows.
+var configMigrations = []migration{
+	// 0 → 1: introduce the version field. Unversioned files come from older
+	// builds or the Python peon-ping and are otherwise compatible.
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+// stateMigrations[i] upgrades .state.json from version i to i+1.
+var stateMigrations = []migration{
+	// 0 → 1: older layouts (including the Python peon-ping) may keep
+	// prompt_timestamps as an object keyed by session; flatten it to the
+	// single list the annoyed check uses.
+	func(m map[string]json.RawMessage) error {
+		raw, ok := m["prompt_timestamps"]
+		if !ok {
+			return nil
+		}
+		var bySession map[string][]float64
+		if json.Unmarshal(raw, &bySession) != nil {
+			return nil // already a list (or unusable; decoding will say)
+		}
+		var all []float64
+		for _, ts := range bySession {
+			all = append(all, ts...)
+		}
+		sort.Float64s(all)
+		m["prompt_timestamps"], _ = json.Marshal(all)
+		return nil
+	},
+}
+
+var (
+	configVersion = len(configMigrations)
+	stateVersion  = len(stateMigrations)
+)
+
+// migrate runs the chain from the file's version up to the latest and stamps
+// the result. Files from a newer peon are left as they are.
+func migrate(m map[string]json.RawMessage, chain []migration) error {
+	v := 0
+	if raw, ok := m["version"]; ok {
+		if err := json.Unmarshal(raw, &v); err != nil || v < 0 {
+			return fmt.Errorf("invalid version %s", raw)
+		}
+	}
+	if v >= len(chain) {
+		return nil
+	}
+	for ; v < len(chain); v++ {
+		if err := chain[v](m); err != nil {
+			return fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
+	m["version"], _ = json.Marshal(v)
+	return nil
+}
+
+// decodeState parses .state.json contents, migrating older versions. An
+// error means the file is corrupt; empty data is an empty state.
+func decodeState(data []byte) (*State, error) {
+	var st State
+	if len(data) > 0 {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		if err := migrate(m, stateMigrations); err != nil {
+			return nil, err
+		}
+		migrated, _ := json.Marshal(m)
+		if err := json.Unmarshal(migrated, &st); err != nil {
+			return nil, err
+		}
+	}
+	if st.LastPlayed == nil {
+		st.LastPlayed = make(map[string]string)
+	}
+	return &st, nil
+}
+
+// quarantineFile saves the contents of a corrupt file next to it as
+// <path>.corrupt-<timestamp> and warns, so a bad file is kept for inspection
+// rather than silently replaced. The bytes are copied so the caller can go
+// on writing a fresh file at path.
+func quarantineFile(path string, data []byte, cause error) {
+	dst := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		logError("quarantine", err)
+		fmt.Fprintf(os.Stderr, "peon-ping: %s is corrupt (%v) and could not be saved: %v\n", path, cause, err)
+		return
+	}
+	logError("quarantine", fmt.Errorf("%s: %v; saved to %s", path, cause, dst))
+	fmt.Fprintf(os.Stderr, "peon-ping: %s is corrupt (%v); saved a copy to %s and starting fresh\n", path, cause, dst)
+}
+
+// importPython implements `peon import-python [dir]`: bring config and
+// state over from an install of the original Python peon-ping (peon.sh plus
+// config.json and .state.json). With dir equal to the peon dir, the files
+// are migrated in place. Settings this build doesn't know are dropped and
+// listed; packs are not copied.
+func importPython(peonDir string, args []string) {
+	src := peonDir
+	if len(args) > 0 {
+		src = args[0]
+	}
+	if !fileExists(filepath.Join(src, "peon.sh")) && !fileExists(filepath.Join(src, "config.json")) {
+		fmt.Fprintf(os.Stderr, "peon-ping: %s doesn't look like a peon-ping install (no peon.sh or config.json)\n", src)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(peonDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Config: imported keys override the current user config.
+	srcCfg := filepath.Join(src, "config.json")
+	if data, err := os.ReadFile(srcCfg); err == nil {
+		m, err := readConfigFile(srcCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: not importing config: %v\n", err)
+			os.Exit(1)
+		}
+		var dropped []string
+		for k := range m {
+			if _, ok := configField(k); !ok && k != "$schema" {
+				dropped = append(dropped, k)
+				delete(m, k)
+			}
+		}
+		dst := filepath.Join(peonDir, "config.json")
+		merged := m
+		if dst != srcCfg {
+			if merged, err = readConfigFile(dst); err != nil {
+				fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+				os.Exit(1)
+			}
+			for k, v := range m {
+				merged[k] = v
+			}
+		} else if err := os.WriteFile(dst+".python-backup", data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: could not back up config: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeConfigFile(dst, merged); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: could not write config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("peon-ping: imported config from %s\n", srcCfg)
+		if len(dropped) > 0 {
+			sort.Strings(dropped)
+			fmt.Printf("  dropped settings this version doesn't support: %v\n", dropped)
+		}
+	}
+
+	// State: merge into the store. In place, opening the store is enough:
+	// it imports the old .state.json on first use.
+	srcState := filepath.Join(src, ".state.json")
+	if src == peonDir {
+		if err := openStore(peonDir).Update(func(*StoreData) error { return nil }); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: could not write state: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("peon-ping: migrated state into %s\n", filepath.Join(stateDir(peonDir), ".store.json"))
+	} else if data, err := os.ReadFile(srcState); err == nil && len(data) > 0 {
+		old, err := decodeState(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: not importing state: %v\n", err)
+		} else {
+			err := openStore(peonDir).Update(func(d *StoreData) error {
+				st := &d.State
+				for cat, file := range old.LastPlayed {
+					if _, ok := st.LastPlayed[cat]; !ok {
+						st.LastPlayed[cat] = file
+					}
+				}
+				st.PromptTimestamps = append(st.PromptTimestamps, old.PromptTimestamps...)
+				sort.Float64s(st.PromptTimestamps)
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "peon-ping: could not write state: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("peon-ping: imported state from %s\n", srcState)
+		}
+	}
+
+	// Packs are large; point at them rather than copying.
+	if src != peonDir {
+		matches, _ := filepath.Glob(filepath.Join(src, "packs", "*", "manifest.json"))
+		for _, m := range matches {
+			name := filepath.Base(filepath.Dir(m))
+			if !fileExists(filepath.Join(packsDir(peonDir), name)) {
+				fmt.Printf("  pack %q not copied: cp -r %s %s\n", name, filepath.Dir(m), packsDir(peonDir))
+			}
+		}
+	}
+}
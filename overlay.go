@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A packs.d overlay changes an installed pack without touching it, so the
+// change survives reinstalls and upgrades. It lives in the config dir:
+//
+//	packs.d/<pack>/manifest.json   categories to add, merge, replace or disable
+//	packs.d/<pack>/sounds/         files the overlay adds
+//
+// Within a category, an overlay sound with the same file as a pack sound
+// replaces it, "disabled": true removes it, and anything else is added. A
+// category with "replace": true uses only the overlay's sounds, and one with
+// "disabled": true is removed.
+
+// overlayDir is where the overlay for a pack lives.
+func overlayDir(peonDir, pack string) string {
+	return filepath.Join(dirsFor(peonDir).Config, "packs.d", pack)
+}
+
+// applyOverlay merges the pack's packs.d overlay, if any, into m.
+func applyOverlay(peonDir, pack string, m *Manifest) error {
+	dir := overlayDir(peonDir, pack)
+	path := filepath.Join(dir, "manifest.json")
+	if !fileExists(path) {
+		return nil
+	}
+	ov, err := cachedLoad(path, func(data []byte) (Manifest, error) {
+		var m Manifest
+		err := json.Unmarshal(data, &m)
+		return m, err
+	})
+	if err != nil {
+		return fmt.Errorf("overlay %s: %w", path, err)
+	}
+
+	source := "packs.d/" + pack
+	m.overlay = dir
+	if ov.DisplayName != "" {
+		m.DisplayName = ov.DisplayName
+	}
+	for name, oc := range ov.Categories {
+		if oc.Disabled {
+			if _, ok := m.Categories[name]; ok {
+				m.removed = append(m.removed, removedEntry{Category: name, Source: source})
+			}
+			delete(m.Categories, name)
+			continue
+		}
+		base := m.Categories[name].Sounds
+		if oc.Replace {
+			for _, s := range base {
+				m.removed = append(m.removed, removedEntry{Category: name, File: s.File, Source: source + " (replace)"})
+			}
+			base = nil
+		}
+		sounds := slices.Clone(base)
+		for _, s := range oc.Sounds {
+			if _, err := safeJoin(dir, s.File); err != nil {
+				logError("overlay", fmt.Errorf("%s: category %s: %w", path, name, err))
+				continue
+			}
+			i := indexSound(sounds, s.File)
+			if s.Disabled {
+				if i >= 0 {
+					sounds = append(sounds[:i], sounds[i+1:]...)
+					m.removed = append(m.removed, removedEntry{Category: name, File: s.File, Source: source})
+				}
+				continue
+			}
+			// A file the overlay ships plays from the overlay; otherwise the
+			// entry re-describes a file the pack already has.
+			s.source = source
+			switch {
+			case fileExists(filepath.Join(dir, "sounds", s.File)):
+				s.dir = filepath.Join(dir, "sounds")
+			case i >= 0:
+				s.dir = sounds[i].dir
+			default:
+				s.dir = filepath.Join(packsDir(peonDir), pack, "sounds")
+			}
+			if i >= 0 {
+				sounds[i] = s
+			} else {
+				sounds = append(sounds, s)
+			}
+		}
+		m.Categories[name] = ManifestCategory{Sounds: sounds}
+	}
+	return nil
+}
+
+// removedEntry records a category or sound an overlay took out, for
+// peon pack show.
+type removedEntry struct {
+	Category string
+	File     string // empty for a whole category
+	Source   string
+}
+
+func indexSound(sounds []ManifestSound, file string) int {
+	return slices.IndexFunc(sounds, func(s ManifestSound) bool { return s.File == file })
+}
+
+// showPack implements `peon pack show <name>`: the effective manifest after
+// extends and overlays, with where each entry came from.
+func showPack(peonDir string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: peon pack show <name>")
+	}
+	name := args[0]
+	if _, err := installedPackDir(peonDir, name); err != nil {
+		return err
+	}
+	m, err := loadManifest(peonDir, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s)\n", name, packDisplayName(m))
+	if m.Extends != "" {
+		fmt.Printf("extends: %s\n", m.Extends)
+	}
+	if m.overlay != "" {
+		fmt.Printf("overlay: %s\n", m.overlay)
+	}
+	cats := make([]string, 0, len(m.Categories))
+	for c := range m.Categories {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for _, c := range cats {
+		fmt.Printf("\n%s\n", c)
+		if len(m.Categories[c].Sounds) == 0 {
+			fmt.Println("  (no sounds)")
+		}
+		for _, s := range m.Categories[c].Sounds {
+			var extra []string
+			if s.Weight != nil {
+				extra = append(extra, fmt.Sprintf("weight %g", *s.Weight))
+			}
+			if s.Volume != nil {
+				extra = append(extra, fmt.Sprintf("volume ×%g", *s.Volume))
+			}
+			if s.MinInterval > 0 {
+				extra = append(extra, fmt.Sprintf("every %gs at most", s.MinInterval))
+			}
+			if len(s.Tags) > 0 {
+				extra = append(extra, "tags "+strings.Join(s.Tags, ","))
+			}
+			missing := ""
+			if !fileExists(soundPath(peonDir, name, s)) {
+				missing = "  MISSING"
+			}
+			line := fmt.Sprintf("  %-28s %-32q %-16s %s%s", s.File, s.Line, s.source, strings.Join(extra, ", "), missing)
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	}
+	if len(m.removed) > 0 {
+		sort.Slice(m.removed, func(i, j int) bool {
+			a, b := m.removed[i], m.removed[j]
+			return a.Category < b.Category || a.Category == b.Category && a.File < b.File
+		})
+		fmt.Println("\nremoved")
+		for _, r := range m.removed {
+			what := r.Category
+			if r.File != "" {
+				what += "/" + r.File
+			}
+			fmt.Printf("  %-28s by %s\n", what, r.Source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const packUsage = `Usage: peon pack <command>
+
+  install <file.zip|file.tar.gz|dir> [--force]
+                            Validate a pack and install it
+  install <name> [--force]  Download, verify and install a registry pack
+  remove <name> [--force]   Delete an installed pack
+  rename <old> <new>        Rename an installed pack
+  new <name> --from <dir> [--display-name <text>] [--normalize] [--yes]
+                            Build a pack from a directory of audio files
+  show <name>               Print the effective manifest (extends and
+                            packs.d overlays applied) with each entry's source
+  lint <name|path>... [--max-duration 10s] [--strict]
+                            Check a pack for problems; exits 1 on errors
+  search [term]             List registry packs
+  outdated                  List registry packs with newer versions
+  upgrade [name...]         Install newer versions of registry packs
+
+install refuses to replace an existing pack unless --force is given. remove
+refuses to delete the active pack unless --force is given. A bare name that
+is not a local file or directory is looked up in the registry, an index.json
+at the URL or path in the pack_registry config key.
+`
+
+// Limits for pack archives, checked against the bytes actually extracted
+// rather than the sizes archive headers claim.
+const (
+	maxPackBytes = 256 << 20
+	maxPackFiles = 2000
+)
+
+var packNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// errPackFailed is returned by subcommands that have already printed why
+// they failed; runPackCmd exits 1 without adding a message.
+var errPackFailed = errors.New("pack command failed")
+
+// runPackCmd implements `peon pack <subcommand>`.
+func runPackCmd(peonDir string, args []string) {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	var err error
+	switch sub {
+	case "install":
+		err = installPackCmd(peonDir, args[1:])
+	case "remove":
+		err = removePack(peonDir, args[1:])
+	case "rename":
+		err = renamePack(peonDir, args[1:])
+	case "new":
+		err = newPackCmd(peonDir, args[1:])
+	case "show":
+		err = showPack(peonDir, args[1:])
+	case "lint":
+		err = lintPackCmd(peonDir, args[1:])
+	case "search":
+		err = searchPacks(peonDir, args[1:])
+	case "outdated":
+		err = outdatedPacks(peonDir)
+	case "upgrade":
+		err = upgradePacks(peonDir, args[1:])
+	case "--help", "-h", "help":
+		fmt.Print(packUsage)
+	default:
+		fmt.Fprint(os.Stderr, packUsage)
+		os.Exit(1)
+	}
+	if err != nil {
+		if !errors.Is(err, errPackFailed) {
+			fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// splitForce separates --force from the other args.
+func splitForce(args []string) (force bool, rest []string) {
+	for _, a := range args {
+		if a == "--force" || a == "-f" {
+			force = true
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return force, rest
+}
+
+func installPackCmd(peonDir string, args []string) error {
+	force, rest := splitForce(args)
+	if len(rest) != 1 {
+		return errors.New("usage: peon pack install <file.zip|file.tar.gz|dir|name> [--force]")
+	}
+	src := rest[0]
+	var m Manifest
+	var err error
+	// A local path wins; only a name with nothing behind it goes to the
+	// registry.
+	if _, serr := os.Stat(src); serr != nil && isRegistryName(src) {
+		idx, err := loadRegistry(peonDir)
+		if err != nil {
+			return err
+		}
+		e, ok := idx.find(src)
+		if !ok {
+			return fmt.Errorf("%s is neither a file nor a pack in the registry", src)
+		}
+		m, err = installFromRegistry(peonDir, idx, e, force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("peon-ping: installed %s %s (%s), %d sounds\n", m.Name, e.Version, packDisplayName(m), countSounds(m))
+		return nil
+	}
+	if m, err = installPack(peonDir, src, "", force); err != nil {
+		return err
+	}
+	fmt.Printf("peon-ping: installed %s (%s), %d sounds\n", m.Name, packDisplayName(m), countSounds(m))
+	return nil
+}
+
+// installPack unpacks src (a zip, a tar.gz or a directory) into a staging
+// dir next to the installed packs, validates it, and renames it into place,
+// so a failed install never leaves a half-written pack behind. A non-empty
+// name is the name the pack must have (registry installs).
+func installPack(peonDir, src, name string, force bool) (Manifest, error) {
+	root := packsDir(peonDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return Manifest{}, err
+	}
+	staging, err := os.MkdirTemp(root, ".install-")
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.RemoveAll(staging)
+	unpacked := filepath.Join(staging, "pack")
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return Manifest{}, err
+	}
+	lower := strings.ToLower(src)
+	switch {
+	case info.IsDir():
+		err = copyPackDir(src, unpacked)
+	case strings.HasSuffix(lower, ".zip"):
+		err = extractZip(src, unpacked)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		err = extractTarGz(src, unpacked)
+	default:
+		err = fmt.Errorf("%s: expected a .zip, .tar.gz or directory", src)
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	dir, err := findPackRoot(unpacked)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("%s: %w", src, err)
+	}
+	m, err := checkPackDir(dir)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("%s: %w", src, err)
+	}
+	switch {
+	case name != "" && m.Name != "" && m.Name != name:
+		return Manifest{}, fmt.Errorf("%s: manifest names the pack %q, expected %q", src, m.Name, name)
+	case name != "":
+		m.Name = name
+	case m.Name == "":
+		m.Name = packNameFromPath(src)
+	}
+	if !packNameRe.MatchString(m.Name) {
+		return Manifest{}, fmt.Errorf("invalid pack name %q", m.Name)
+	}
+
+	dst := filepath.Join(root, m.Name)
+	if fileExists(dst) {
+		if !force {
+			return Manifest{}, fmt.Errorf("pack %q is already installed (use --force to replace it)", m.Name)
+		}
+		// Move the old pack aside inside staging; the deferred cleanup
+		// deletes it once the new one is in place.
+		if err := os.Rename(dst, filepath.Join(staging, "replaced")); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := os.Rename(dir, dst); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// isRegistryName reports whether an install argument names a registry pack
+// rather than a local file: a bare name with no path separator or archive
+// extension. Callers check for a local path of that name first.
+func isRegistryName(src string) bool {
+	lower := strings.ToLower(src)
+	return packNameRe.MatchString(src) && !strings.ContainsRune(src, filepath.Separator) &&
+		!strings.HasSuffix(lower, ".zip") && !strings.HasSuffix(lower, ".tar.gz") && !strings.HasSuffix(lower, ".tgz")
+}
+
+// packNameFromPath derives a pack name from an archive or directory name.
+func packNameFromPath(src string) string {
+	name := filepath.Base(filepath.Clean(src))
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// findPackRoot returns the directory holding manifest.json: the extraction
+// dir itself, or its single top-level directory (archives made with
+// `zip -r pack.zip mypack/`).
+func findPackRoot(dir string) (string, error) {
+	if fileExists(filepath.Join(dir, "manifest.json")) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		sub := filepath.Join(dir, entries[0].Name())
+		if fileExists(filepath.Join(sub, "manifest.json")) {
+			return sub, nil
+		}
+	}
+	return "", errors.New("no manifest.json found")
+}
+
+// checkPackDir parses a pack's manifest and checks that it has sounds and
+// that every file it references exists inside sounds/.
+func checkPackDir(dir string) (Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("manifest.json: %w", err)
+	}
+	if countSounds(m) == 0 && m.Extends == "" {
+		return Manifest{}, errors.New("manifest.json lists no sounds")
+	}
+	for cat, c := range m.Categories {
+		for _, s := range c.Sounds {
+			p, err := safeJoin(filepath.Join(dir, "sounds"), s.File)
+			if err != nil {
+				return Manifest{}, fmt.Errorf("category %s: %w", cat, err)
+			}
+			if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+				return Manifest{}, fmt.Errorf("category %s: sounds/%s is missing", cat, s.File)
+			}
+		}
+	}
+	return m, nil
+}
+
+// safeJoin joins a relative archive or manifest path onto root, rejecting
+// anything that would land outside it (zip-slip).
+func safeJoin(root, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if name == "" || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("unsafe path %q", name)
+	}
+	clean := filepath.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe path %q", name)
+	}
+	return filepath.Join(root, clean), nil
+}
+
+// extractLimits tracks the size and file count of an extraction.
+type extractLimits struct {
+	bytes int64
+	files int
+}
+
+// writeFile copies r to path, counting against the limits.
+func (l *extractLimits) writeFile(path string, r io.Reader) error {
+	if l.files++; l.files > maxPackFiles {
+		return fmt.Errorf("pack has more than %d files", maxPackFiles)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, maxPackBytes-l.bytes+1))
+	l.bytes += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && l.bytes > maxPackBytes {
+		err = fmt.Errorf("pack is larger than %d MB", maxPackBytes>>20)
+	}
+	return err
+}
+
+func extractZip(src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	var lim extractLimits
+	for _, f := range zr.File {
+		p, err := safeJoin(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		case !mode.IsRegular():
+			return fmt.Errorf("%s: only regular files are allowed", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = lim.writeFile(p, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	var lim extractLimits
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue // pax metadata
+		}
+		p, err := safeJoin(dst, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := lim.writeFile(p, tr); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: only regular files are allowed", h.Name)
+		}
+	}
+}
+
+// copyPackDir copies a pack directory, with the same limits as an archive.
+// Symlinks are refused so a pack can't point outside itself.
+func copyPackDir(src, dst string) error {
+	var lim extractLimits
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !d.Type().IsRegular():
+			return fmt.Errorf("%s: only regular files are allowed", p)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return lim.writeFile(target, f)
+	})
+}
+
+// removePack implements `peon pack remove <name> [--force]`.
+func removePack(peonDir string, args []string) error {
+	force, rest := splitForce(args)
+	if len(rest) != 1 {
+		return errors.New("usage: peon pack remove <name> [--force]")
+	}
+	name := rest[0]
+	dir, err := installedPackDir(peonDir, name)
+	if err != nil {
+		return err
+	}
+	if name == loadConfig(peonDir).ActivePack && !force {
+		return fmt.Errorf("%s is the active pack; switch with 'peon --pack <name>' first, or use --force", name)
+	}
+	if packs, _ := listPacks(peonDir); !force {
+		for _, p := range packs {
+			if p.Extends == name {
+				return fmt.Errorf("pack %s extends %s; remove it first, or use --force", filepath.Base(p.dir), name)
+			}
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	fmt.Printf("peon-ping: removed pack %s\n", name)
+	return nil
+}
+
+// renamePack implements `peon pack rename <old> <new>`: rename the directory,
+// update the manifest's name, move its packs.d overlay, and follow the rename
+// in the user config. A pack that others extend is not renamed.
+func renamePack(peonDir string, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: peon pack rename <old> <new>")
+	}
+	from, to := args[0], args[1]
+	dir, err := installedPackDir(peonDir, from)
+	if err != nil {
+		return err
+	}
+	if !packNameRe.MatchString(to) {
+		return fmt.Errorf("invalid pack name %q", to)
+	}
+	dst := filepath.Join(packsDir(peonDir), to)
+	if fileExists(dst) {
+		return fmt.Errorf("pack %q already exists", to)
+	}
+	// extends names the directory, so children would lose their parent.
+	packs, _ := listPacks(peonDir)
+	for _, p := range packs {
+		if p.Extends == from {
+			return fmt.Errorf("pack %s extends %s; renaming it would break that", filepath.Base(p.dir), from)
+		}
+	}
+
+	// Rewrite the name key only, keeping the rest of the manifest as is.
+	mpath := filepath.Join(dir, "manifest.json")
+	data, err := os.ReadFile(mpath)
+	if err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%s: %w", mpath, err)
+	}
+	raw["name"], _ = json.Marshal(to)
+	out, _ := json.MarshalIndent(raw, "", "  ")
+	if err := atomicWriteFile(mpath, append(out, '\n')); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, dst); err != nil {
+		return err
+	}
+	if ov := overlayDir(peonDir, from); fileExists(ov) && !fileExists(overlayDir(peonDir, to)) {
+		if err := os.Rename(ov, overlayDir(peonDir, to)); err != nil {
+			return fmt.Errorf("renamed, but could not move the packs.d overlay: %w", err)
+		}
+	}
+
+	if cfg := loadUserConfig(peonDir); cfg.ActivePack == from {
+		cfg.ActivePack = to
+		if err := saveConfig(peonDir, cfg); err != nil {
+			return fmt.Errorf("renamed, but could not update config: %w", err)
+		}
+	}
+	fmt.Printf("peon-ping: renamed pack %s to %s\n", from, to)
+	return nil
+}
+
+// installedPackDir returns the directory of an installed pack.
+func installedPackDir(peonDir, name string) (string, error) {
+	if !packNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid pack name %q", name)
+	}
+	dir := filepath.Join(packsDir(peonDir), name)
+	if !fileExists(filepath.Join(dir, "manifest.json")) {
+		return "", fmt.Errorf("pack %q is not installed", name)
+	}
+	return dir, nil
+}
+
+// countSounds returns the number of sound entries in a manifest.
+func countSounds(m Manifest) int {
+	n := 0
+	for _, c := range m.Categories {
+		n += len(c.Sounds)
+	}
+	return n
+}
+
+func packDisplayName(m Manifest) string {
+	if m.DisplayName != "" {
+		return m.DisplayName
+	}
+	return m.Name
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// formatSize renders a byte count for humans.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -2,7 +2,8 @@
 // Translates OpenCode events into peon-ping generic JSON format
 // for sounds, notifications, and action bar integration.
 
-import { spawnSync } from "child_process";
+import { spawn, ChildProcess } from "child_process";
+import { createInterface } from "readline";
 import { existsSync } from "fs";
 import { join } from "path";
 import { homedir } from "os";
@@ -13,14 +14,64 @@ const peonBin = (() => {
   return "peon";
 })();
 
-function sendToPeon(event: Record<string, unknown>) {
+type PeonResult = { id?: number; output?: { decision: string; apply_suggestions?: boolean } };
+
+// One long-lived `peon --stream` process per OpenCode instance. Events are
+// written as NDJSON lines tagged with an id; peon answers each with a result
+// line carrying the same id.
+let stream: ChildProcess | null = null;
+let nextId = 1;
+const pending = new Map<number, (res: PeonResult) => void>();
+
+function peonStream(): ChildProcess | null {
+  if (stream && stream.exitCode === null && !stream.killed) return stream;
   try {
-    spawnSync(peonBin, [], {
-      input: JSON.stringify(event),
-      timeout: 5000,
-      stdio: ["pipe", "ignore", "ignore"],
+    const child = spawn(peonBin, ["--stream", "--results"], { stdio: ["pipe", "pipe", "ignore"] });
+    createInterface({ input: child.stdout! }).on("line", (line) => {
+      try {
+        const res: PeonResult = JSON.parse(line);
+        const done = res.id !== undefined ? pending.get(res.id) : undefined;
+        if (done) {
+          pending.delete(res.id!);
+          done(res);
+        }
+      } catch {}
     });
-  } catch {}
+    const reset = () => {
+      if (stream === child) stream = null;
+      for (const done of pending.values()) done({});
+      pending.clear();
+    };
+    child.on("error", reset);
+    child.on("exit", reset);
+    child.stdin!.on("error", () => {});
+    stream = child;
+    return child;
+  } catch {
+    return null;
+  }
+}
+
+function writeToPeon(event: Record<string, unknown>): Promise<PeonResult> {
+  return new Promise((resolve) => {
+    const child = peonStream();
+    if (!child) return resolve({});
+    const id = nextId++;
+    pending.set(id, resolve);
+    child.stdin!.write(JSON.stringify({ version: 2, id, ...event }) + "\n");
+  });
+}
+
+function sendToPeon(event: Record<string, unknown>) {
+  writeToPeon(event);
+}
+
+// askPeon sends a permission_request and resolves with peon's decision
+// ("allow", "deny" or "ask"). peon answers once the action bar does, so
+// other events keep flowing through the stream in the meantime.
+async function askPeon(event: Record<string, unknown>): Promise<{ decision: string; apply_suggestions?: boolean }> {
+  const res = await writeToPeon({ type: "permission_request", ...event });
+  return res.output || { decision: "ask" };
 }
 
 export const PeonPing = async (ctx: any) => {
@@ -59,14 +110,28 @@ export const PeonPing = async (ctx: any) => {
           break;
         }
 
-        case "permission.updated":
-          sendToPeon({
-            type: "permission_needed",
+        case "permission.updated": {
+          // Don't await: the action bar answer may take minutes, and OpenCode
+          // keeps its own prompt open in the meantime.
+          askPeon({
             cwd,
             session_id: sessionId,
             message: props.title || "Permission needed",
+            tool_name: props.type,
+            tool_input: props.metadata,
+          }).then(async (rsp) => {
+            if (rsp.decision === "ask" || !props.id) return;
+            const response =
+              rsp.decision === "allow" ? (rsp.apply_suggestions ? "always" : "once") : "reject";
+            try {
+              await ctx.client.postSessionIdPermissionsPermissionId({
+                path: { id: sessionId, permissionID: props.id },
+                body: { response },
+              });
+            } catch {}
           });
           break;
+        }
       }
     },
   };
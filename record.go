@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// captureEntry is one line of a capture file: a raw hook payload (redacted)
+// plus what peon did with it.
+type captureEntry struct {
+	Time    time.Time       `json:"ts"`
+	Harness string          `json:"harness"`
+	Payload json.RawMessage `json:"payload"`
+	Outcome hookResult      `json:"outcome"`
+}
+
+// capturePath is where recorded payloads are appended.
+func capturePath(peonDir string) string {
+	return filepath.Join(stateDir(peonDir), "capture.jsonl")
+}
+
+// recordingEnabled reports whether payloads should be captured, either via
+// PEON_RECORD=1 or `peon --record on` (which creates a .record flag file).
+func recordingEnabled(peonDir string) bool {
+	if v := os.Getenv("PEON_RECORD"); v != "" && v != "0" {
+		return true
+	}
+	return fileExists(filepath.Join(dirsFor(peonDir).State, ".record"))
+}
+
+// redactedFields hold free text, file contents or paths that may be private.
+// They are replaced before a payload is written to the capture file.
+var redactedFields = map[string]bool{
+	"message":                true,
+	"prompt":                 true,
+	"title":                  true,
+	"tool_input":             true,
+	"permission_suggestions": true,
+	"transcript_path":        true,
+	"sound":                  true,
+	"project":                true,
+}
+
+// redactPayload masks private fields and shortens cwd to its last element
+// (which peon uses as the project name) so captures can be attached to
+// public issues. Non-object payloads are dropped entirely.
+func redactPayload(raw []byte) json.RawMessage {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return json.RawMessage(`"[unparseable payload redacted]"`)
+	}
+	for k := range m {
+		if redactedFields[k] {
+			m[k] = json.RawMessage(`"[redacted]"`)
+		}
+	}
+	if c, ok := m["cwd"]; ok {
+		var cwd string
+		if json.Unmarshal(c, &cwd) == nil && cwd != "" {
+			m["cwd"], _ = json.Marshal("/redacted/" + filepath.Base(cwd))
+		}
+	}
+	out, _ := json.Marshal(m)
+	return out
+}
+
+// redactOutcome strips an outcome of what redactPayload would hide: the
+// sound becomes a path relative to the packs dir (or just its file name),
+// and the tab title and permission answer are masked.
+func redactOutcome(peonDir string, res hookResult) hookResult {
+	if res.Sound != "" {
+		if rel, err := filepath.Rel(packsDir(peonDir), res.Sound); err == nil && !strings.HasPrefix(rel, "..") {
+			res.Sound = filepath.ToSlash(rel)
+		} else {
+			res.Sound = filepath.Base(res.Sound)
+		}
+	}
+	if res.Title != "" {
+		res.Title = "[redacted]"
+	}
+	if res.Output != nil {
+		res.Output = json.RawMessage(`"[redacted]"`)
+	}
+	return res
+}
+
+// recordHook appends a payload and its outcome to the capture file when
+// recording is on. Errors are ignored like everywhere else in the hook path.
+func recordHook(peonDir string, input []byte, res hookResult) {
+	if !recordingEnabled(peonDir) {
+		return
+	}
+	entry := captureEntry{
+		Time:    time.Now(),
+		Harness: res.Harness,
+		Payload: redactPayload(input),
+		Outcome: redactOutcome(peonDir, res),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(capturePath(peonDir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// setRecording implements `peon --record on|off|status`.
+func setRecording(peonDir, mode string) {
+	flag := filepath.Join(stateDir(peonDir), ".record")
+	switch mode {
+	case "on":
+		if err := os.WriteFile(flag, nil, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("peon-ping: recording hook payloads to %s\n", capturePath(peonDir))
+	case "off":
+		os.Remove(flag)
+		fmt.Println("peon-ping: recording stopped")
+	case "", "status":
+		if recordingEnabled(peonDir) {
+			fmt.Printf("peon-ping: recording to %s\n", capturePath(peonDir))
+		} else {
+			fmt.Println("peon-ping: not recording")
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: peon --record on|off|status")
+		os.Exit(1)
+	}
+}
+
+// runReplay implements `peon --replay <capture.jsonl> [--speed 10x] [--dry-run]`.
+// Entries are fed through handleHook against a scratch peon dir that shares
+// the real config and packs but has its own state, so replays never disturb
+// live sessions. Each replayed outcome is compared with the recorded one;
+// the exit status is non-zero if any differ, so captures work as regression
+// fixtures.
+func runReplay(peonDir string, args []string) {
+	var file string
+	speed := 1.0
+	dryRun := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--speed" && i+1 < len(args):
+			v := args[i+1]
+			if v == "max" {
+				speed = 0
+			} else if s, err := strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64); err == nil && s >= 0 {
+				speed = s
+			} else {
+				fmt.Fprintf(os.Stderr, "peon-ping: invalid speed %q\n", args[i+1])
+				os.Exit(1)
+			}
+			i++
+		case args[i] == "--dry-run":
+			dryRun = true
+		default:
+			file = args[i]
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "Usage: peon --replay <capture.jsonl> [--speed 10x|max] [--dry-run]")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	scratch, err := newScratchPeonDir(peonDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not create scratch dir: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(scratch)
+
+	var prev time.Time
+	n, mismatches := 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry captureEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		n++
+
+		// Keep the recorded pacing (scaled), so timing-dependent logic like
+		// the annoyed check sees similar gaps.
+		if speed > 0 && !prev.IsZero() && !dryRun {
+			if gap := entry.Time.Sub(prev); gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / speed))
+			}
+		}
+		prev = entry.Time
+
+		fmt.Printf("#%d %s %s\n", n, entry.Time.Format(time.RFC3339), entry.Outcome.Event)
+
+		// Nobody will answer a permission request in the scratch dir.
+		var probe struct {
+			Type          string `json:"type"`
+			HookEventName string `json:"hook_event_name"`
+		}
+		json.Unmarshal(entry.Payload, &probe)
+		opts := hookOptions{DryRun: dryRun}
+		if dryRun {
+			opts.Explain = func(line string) { fmt.Println("    " + line) }
+		}
+		if probe.Type == "permission_request" || probe.HookEventName == "PermissionRequest" {
+			opts.DryRun = true
+		}
+
+		got := handleHook(scratch, entry.Payload, opts)
+		if diff := compareOutcomes(entry.Outcome, got); diff != "" {
+			mismatches++
+			fmt.Printf("    MISMATCH: %s\n", diff)
+		}
+	}
+	fmt.Printf("peon-ping: replayed %d event(s), %d mismatch(es)\n", n, mismatches)
+	if mismatches > 0 {
+		os.RemoveAll(scratch) // os.Exit skips defers
+		os.Exit(1)
+	}
+}
+
+// compareOutcomes reports the differences that matter between a recorded and
+// a replayed result. Sound files are picked at random, so only whether a
+// sound played is compared, not which one.
+func compareOutcomes(want, got hookResult) string {
+	var diffs []string
+	if want.Event != got.Event {
+		diffs = append(diffs, fmt.Sprintf("event %q → %q", want.Event, got.Event))
+	}
+	if want.Category != got.Category {
+		diffs = append(diffs, fmt.Sprintf("category %q → %q", want.Category, got.Category))
+	}
+	if (want.Sound != "") != (got.Sound != "") {
+		diffs = append(diffs, fmt.Sprintf("sound played %v → %v", want.Sound != "", got.Sound != ""))
+	}
+	if want.Notified != got.Notified {
+		diffs = append(diffs, fmt.Sprintf("notified %v → %v", want.Notified, got.Notified))
+	}
+	if want.Skipped != got.Skipped {
+		diffs = append(diffs, fmt.Sprintf("skipped %q → %q", want.Skipped, got.Skipped))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// newScratchPeonDir creates a temporary peon dir that shares config.json and
+// packs with peonDir but starts with empty runtime state.
+func newScratchPeonDir(peonDir string) (string, error) {
+	dir, err := os.MkdirTemp("", "peon-replay-")
+	if err != nil {
+		return "", err
+	}
+	if data, err := os.ReadFile(filepath.Join(peonDir, "config.json")); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), data, 0644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	if packs, err := filepath.Abs(packsDir(peonDir)); err == nil && fileExists(packs) {
+		if err := os.Symlink(packs, filepath.Join(dir, "packs")); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
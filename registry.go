@@ -0,0 +1,385 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// registryIndexVersion is the newest index format this build understands.
+const registryIndexVersion = 1
+
+// registryIndex is a pack registry's index.json.
+type registryIndex struct {
+	Version int             `json:"version"`
+	Packs   []registryEntry `json:"packs"`
+
+	base      string // where the index was loaded from, for relative URLs
+	allowHTTP bool   // pack_registry_allow_http
+}
+
+// registryEntry describes one downloadable pack. URL may be relative to the
+// index.
+type registryEntry struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Version     string `json:"version"`
+	URL         string `json:"url"`
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size,omitempty"`
+	Description string `json:"description,omitempty"`
+	License     string `json:"license,omitempty"`
+}
+
+// packOrigin is written to <pack>/.origin.json when a pack is installed from
+// a registry, so outdated and upgrade know what is installed.
+type packOrigin struct {
+	Registry string `json:"registry"`
+	Version  string `json:"version"`
+	SHA256   string `json:"sha256"`
+}
+
+const packOriginFile = ".origin.json"
+
+// registryClient is used for index and archive downloads.
+var registryClient = http.Client{Timeout: 60 * time.Second}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// openRegistryRef opens an index or archive by URL or file path. Plain
+// http is refused unless allowHTTP is set, redirects included.
+func openRegistryRef(ref string, allowHTTP bool) (io.ReadCloser, error) {
+	if !isURL(ref) {
+		return os.Open(ref)
+	}
+	if strings.HasPrefix(ref, "http://") && !allowHTTP {
+		return nil, fmt.Errorf("%s: refusing plain http (use https, or peon config set pack_registry_allow_http true)", ref)
+	}
+	client := registryClient
+	if !allowHTTP {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing redirect to %s", req.URL.Scheme)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+	}
+	resp, err := client.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", ref, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// registryConfig returns the config from the user and env layers only. The
+// index supplies the checksums, so a project's .peon.json (or a system
+// file) must not be able to choose it.
+func registryConfig(peonDir string) Config {
+	var layers []configLayer
+	for _, l := range configLayers(peonDir, "") {
+		if l.Name == "user" || l.Name == "env" {
+			layers = append(layers, l)
+		}
+	}
+	cfg, _ := mergeConfigLayers(layers)
+	return cfg
+}
+
+// loadRegistry fetches the index named by the pack_registry config key.
+func loadRegistry(peonDir string) (*registryIndex, error) {
+	cfg := registryConfig(peonDir)
+	ref := cfg.PackRegistry
+	if ref == "" {
+		return nil, errors.New("no pack registry configured (peon config set pack_registry <url or file>)")
+	}
+	r, err := openRegistryRef(ref, cfg.PackRegistryHTTP)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var idx registryIndex
+	if err := json.NewDecoder(io.LimitReader(r, 16<<20)).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("registry index %s: %w", ref, err)
+	}
+	if idx.Version > registryIndexVersion {
+		return nil, fmt.Errorf("registry index %s is version %d; this peon understands up to %d", ref, idx.Version, registryIndexVersion)
+	}
+	idx.base = ref
+	idx.allowHTTP = cfg.PackRegistryHTTP
+	return &idx, nil
+}
+
+// find returns the entry for a pack name.
+func (idx *registryIndex) find(name string) (registryEntry, bool) {
+	for _, e := range idx.Packs {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return registryEntry{}, false
+}
+
+// resolve turns an entry's URL into an absolute URL or path. Against a
+// remote index every ref resolves to a URL, "/dl/x.zip" included, so a
+// remote index can never point peon at a local file.
+func (idx *registryIndex) resolve(ref string) string {
+	if isURL(ref) {
+		return ref
+	}
+	if isURL(idx.base) {
+		if base, err := url.Parse(idx.base); err == nil {
+			if u, err := base.Parse(ref); err == nil {
+				return u.String()
+			}
+		}
+		return ref
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(idx.base), filepath.FromSlash(ref))
+}
+
+// downloadEntry fetches a pack archive into a temp file, checking its size
+// and sha256 against the index. The caller removes the returned file.
+func downloadEntry(idx *registryIndex, e registryEntry) (string, error) {
+	if e.SHA256 == "" {
+		return "", fmt.Errorf("registry entry %s has no sha256; refusing to install it", e.Name)
+	}
+	if e.Size > maxPackBytes {
+		return "", fmt.Errorf("%s is %s, over the %d MB pack limit", e.Name, formatSize(e.Size), maxPackBytes>>20)
+	}
+	src := idx.resolve(e.URL)
+	if isURL(idx.base) && !isURL(src) {
+		return "", fmt.Errorf("registry entry %s: %q is not an http(s) URL", e.Name, e.URL)
+	}
+	r, err := openRegistryRef(src, idx.allowHTTP)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	// Keep the archive's extension; installPack goes by it.
+	ext := ".zip"
+	if p := strings.ToLower(path.Base(src)); strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".tgz") {
+		ext = ".tar.gz"
+	}
+	f, err := os.CreateTemp("", "peon-pack-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, maxPackBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+	case n > maxPackBytes:
+		err = fmt.Errorf("%s is over the %d MB pack limit", src, maxPackBytes>>20)
+	case e.Size > 0 && n != e.Size:
+		err = fmt.Errorf("%s: got %d bytes, index says %d", src, n, e.Size)
+	case !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), e.SHA256):
+		err = fmt.Errorf("%s: sha256 mismatch (got %x, index says %s)", src, h.Sum(nil), e.SHA256)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// installFromRegistry downloads, verifies and installs a registry pack, and
+// records where it came from.
+func installFromRegistry(peonDir string, idx *registryIndex, e registryEntry, force bool) (Manifest, error) {
+	if !force && fileExists(filepath.Join(packsDir(peonDir), e.Name)) {
+		// Checked again by installPack; this saves the download.
+		return Manifest{}, fmt.Errorf("pack %q is already installed (use --force to replace it)", e.Name)
+	}
+	archive, err := downloadEntry(idx, e)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.Remove(archive)
+	m, err := installPack(peonDir, archive, e.Name, force)
+	if err != nil {
+		return Manifest{}, err
+	}
+	origin, _ := json.MarshalIndent(packOrigin{Registry: idx.base, Version: e.Version, SHA256: strings.ToLower(e.SHA256)}, "", "  ")
+	if err := os.WriteFile(filepath.Join(packsDir(peonDir), e.Name, packOriginFile), origin, 0644); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// installedOrigin returns the registry record of an installed pack, if any.
+func installedOrigin(peonDir, name string) (packOrigin, bool) {
+	var o packOrigin
+	data, err := os.ReadFile(filepath.Join(packsDir(peonDir), name, packOriginFile))
+	if err != nil || json.Unmarshal(data, &o) != nil {
+		return o, false
+	}
+	return o, true
+}
+
+// searchPacks implements `peon pack search [term]`.
+func searchPacks(peonDir string, args []string) error {
+	idx, err := loadRegistry(peonDir)
+	if err != nil {
+		return err
+	}
+	term := strings.ToLower(strings.Join(args, " "))
+	entries := append([]registryEntry(nil), idx.Packs...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	found := 0
+	for _, e := range entries {
+		text := strings.ToLower(e.Name + " " + e.DisplayName + " " + e.Description)
+		if term != "" && !strings.Contains(text, term) {
+			continue
+		}
+		found++
+		marker := ""
+		if o, ok := installedOrigin(peonDir, e.Name); ok {
+			marker = " [installed " + o.Version + "]"
+		} else if fileExists(filepath.Join(packsDir(peonDir), e.Name, "manifest.json")) {
+			marker = " [installed]"
+		}
+		size := ""
+		if e.Size > 0 {
+			size = formatSize(e.Size)
+		}
+		fmt.Printf("  %-24s %-10s %9s  %s%s\n", e.Name, e.Version, size, e.License, marker)
+		if e.Description != "" {
+			fmt.Printf("      %s\n", e.Description)
+		}
+	}
+	if found == 0 {
+		fmt.Println("peon-ping: no packs found")
+	}
+	return nil
+}
+
+// outdatedPack is an installed registry pack with a newer version available.
+type outdatedPack struct {
+	entry     registryEntry
+	installed string
+}
+
+// findOutdated compares installed registry packs with the index.
+func findOutdated(peonDir string, idx *registryIndex) []outdatedPack {
+	packs, _ := listPacks(peonDir)
+	var out []outdatedPack
+	for _, p := range packs {
+		name := filepath.Base(p.dir)
+		o, ok := installedOrigin(peonDir, name)
+		if !ok {
+			continue
+		}
+		if e, ok := idx.find(name); ok && compareVersions(e.Version, o.Version) > 0 {
+			out = append(out, outdatedPack{entry: e, installed: o.Version})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].entry.Name < out[j].entry.Name })
+	return out
+}
+
+// outdatedPacks implements `peon pack outdated`. It returns errPackFailed
+// when something is out of date, so scripts can check the exit status.
+func outdatedPacks(peonDir string) error {
+	idx, err := loadRegistry(peonDir)
+	if err != nil {
+		return err
+	}
+	out := findOutdated(peonDir, idx)
+	if len(out) == 0 {
+		fmt.Println("peon-ping: all registry packs are up to date")
+		return nil
+	}
+	for _, o := range out {
+		fmt.Printf("  %-24s %s → %s\n", o.entry.Name, o.installed, o.entry.Version)
+	}
+	return errPackFailed
+}
+
+// upgradePacks implements `peon pack upgrade [name...]`: reinstall outdated
+// registry packs, all of them or the named ones.
+func upgradePacks(peonDir string, names []string) error {
+	idx, err := loadRegistry(peonDir)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	upgraded := 0
+	for _, o := range findOutdated(peonDir, idx) {
+		if len(names) > 0 && !slices.Contains(names, o.entry.Name) {
+			continue
+		}
+		if _, err := installFromRegistry(peonDir, idx, o.entry, true); err != nil {
+			fmt.Fprintf(os.Stderr, "peon-ping: %s: %v\n", o.entry.Name, err)
+			failed = append(failed, o.entry.Name)
+			continue
+		}
+		upgraded++
+		fmt.Printf("peon-ping: upgraded %s %s → %s\n", o.entry.Name, o.installed, o.entry.Version)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not upgrade %s", strings.Join(failed, ", "))
+	}
+	if upgraded == 0 {
+		fmt.Println("peon-ping: nothing to upgrade")
+	}
+	return nil
+}
+
+// compareVersions compares dotted versions numerically where it can
+// ("1.10" > "1.9"), falling back to string order per component. A leading
+// "v" is ignored and missing components count as 0.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// packZip builds a minimal pack archive.
+func packZip(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"manifest.json":   `{"name":"` + name + `","display_name":"Test","categories":{"complete":{"sounds":[{"file":"done.wav","line":"Done"}]}}}`,
+		"sounds/done.wav": "RIFF",
+	}
+	for n, body := range files {
+		w, err := zw.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// testRegistry serves index.json and archives from files, and points a new
+// peon dir at it.
+type testRegistry struct {
+	peonDir string
+	srv     *httptest.Server
+	files   map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{peonDir: t.TempDir(), files: make(map[string][]byte)}
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, ok := r.files[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(r.srv.Close)
+	cfg, _ := json.Marshal(map[string]any{
+		"pack_registry":            r.srv.URL + "/index.json",
+		"pack_registry_allow_http": true,
+	})
+	if err := os.WriteFile(filepath.Join(r.peonDir, "config.json"), cfg, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// publish serves the entries as the index.
+func (r *testRegistry) publish(t *testing.T, entries ...registryEntry) *registryIndex {
+	t.Helper()
+	r.files["index.json"], _ = json.Marshal(registryIndex{Version: 1, Packs: entries})
+	idx, err := loadRegistry(r.peonDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	r := newTestRegistry(t)
+	archive := packZip(t, "mypack")
+	r.files["mypack.zip"] = archive
+	idx := r.publish(t, registryEntry{Name: "mypack", Version: "1.0", URL: "mypack.zip", SHA256: sha([]byte("something else"))})
+
+	e, _ := idx.find("mypack")
+	_, err := installFromRegistry(r.peonDir, idx, e, false)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("want sha256 mismatch, got %v", err)
+	}
+	if fileExists(filepath.Join(packsDir(r.peonDir), "mypack")) {
+		t.Error("pack was installed despite the mismatch")
+	}
+}
+
+func TestDownloadSizeChecks(t *testing.T) {
+	r := newTestRegistry(t)
+	archive := packZip(t, "mypack")
+	r.files["mypack.zip"] = archive
+	idx := r.publish(t,
+		registryEntry{Name: "wrongsize", Version: "1.0", URL: "mypack.zip", SHA256: sha(archive), Size: int64(len(archive)) + 1},
+		registryEntry{Name: "huge", Version: "1.0", URL: "mypack.zip", SHA256: sha(archive), Size: maxPackBytes + 1},
+	)
+
+	for name, want := range map[string]string{"wrongsize": "index says", "huge": "pack limit"} {
+		e, _ := idx.find(name)
+		if _, err := downloadEntry(idx, e); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestRefuseHTTPWithoutOptIn(t *testing.T) {
+	r := newTestRegistry(t)
+	os.WriteFile(filepath.Join(r.peonDir, "config.json"), []byte(`{"pack_registry":"`+r.srv.URL+`/index.json"}`), 0644)
+	if _, err := loadRegistry(r.peonDir); err == nil || !strings.Contains(err.Error(), "plain http") {
+		t.Fatalf("want plain http refused, got %v", err)
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	tests := []struct{ base, ref, want string }{
+		{"https://example.com/packs/index.json", "peon-1.0.zip", "https://example.com/packs/peon-1.0.zip"},
+		{"https://example.com/packs/index.json", "../dl/peon.zip", "https://example.com/dl/peon.zip"},
+		{"https://example.com/packs/index.json", "/dl/peon.zip", "https://example.com/dl/peon.zip"},
+		{"/srv/registry/index.json", "/dl/peon.zip", "/dl/peon.zip"},
+		{"https://example.com/packs/index.json", "https://cdn.example.com/peon.zip", "https://cdn.example.com/peon.zip"},
+		{"/srv/registry/index.json", "peon.zip", filepath.Join("/srv/registry", "peon.zip")},
+		{"/srv/registry/index.json", "sub/peon.zip", filepath.Join("/srv/registry", "sub", "peon.zip")},
+	}
+	for _, tt := range tests {
+		idx := &registryIndex{base: tt.base}
+		if got := idx.resolve(tt.ref); got != tt.want {
+			t.Errorf("resolve(%q) against %q = %q, want %q", tt.ref, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"v1.2", "1.2", 0},
+		{"1.10", "1.9", 1},
+		{"1.9", "1.10", -1},
+		{"2", "1.99.99", 1},
+		{"1.0.1", "1.0", 1},
+		{"1.0-beta", "1.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestOutdatedAndUpgrade(t *testing.T) {
+	r := newTestRegistry(t)
+	v1 := packZip(t, "mypack")
+	r.files["mypack-1.0.zip"] = v1
+	idx := r.publish(t, registryEntry{Name: "mypack", Version: "1.0", URL: "mypack-1.0.zip", SHA256: sha(v1)})
+	e, _ := idx.find("mypack")
+	if _, err := installFromRegistry(r.peonDir, idx, e, false); err != nil {
+		t.Fatal(err)
+	}
+	if out := findOutdated(r.peonDir, idx); len(out) != 0 {
+		t.Fatalf("fresh install reported outdated: %+v", out)
+	}
+
+	v2 := packZip(t, "mypack")
+	r.files["mypack-1.1.zip"] = v2
+	idx = r.publish(t, registryEntry{Name: "mypack", Version: "1.1", URL: "mypack-1.1.zip", SHA256: sha(v2)})
+	out := findOutdated(r.peonDir, idx)
+	if len(out) != 1 || out[0].installed != "1.0" || out[0].entry.Version != "1.1" {
+		t.Fatalf("findOutdated = %+v, want mypack 1.0 → 1.1", out)
+	}
+
+	if err := upgradePacks(r.peonDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := installedOrigin(r.peonDir, "mypack"); !ok || o.Version != "1.1" {
+		t.Errorf("after upgrade origin = %+v, %v; want version 1.1", o, ok)
+	}
+	if out := findOutdated(r.peonDir, idx); len(out) != 0 {
+		t.Errorf("still outdated after upgrade: %+v", out)
+	}
+}
+
+func TestRefuseRedirectToHTTP(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"version":1}`))
+	}))
+	defer plain.Close()
+	tls := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, plain.URL+"/index.json", http.StatusFound)
+	}))
+	defer tls.Close()
+	saved := registryClient
+	registryClient.Transport = tls.Client().Transport
+	t.Cleanup(func() { registryClient = saved })
+
+	if _, err := openRegistryRef(tls.URL+"/index.json", false); err == nil || !strings.Contains(err.Error(), "refusing redirect") {
+		t.Fatalf("want redirect to http refused, got %v", err)
+	}
+	r, err := openRegistryRef(tls.URL+"/index.json", true)
+	if err != nil {
+		t.Fatalf("with pack_registry_allow_http: %v", err)
+	}
+	r.Close()
+}
+
+func TestRemoteIndexNeverOpensLocalFiles(t *testing.T) {
+	r := newTestRegistry(t)
+	local := filepath.Join(t.TempDir(), "local.zip")
+	archive := packZip(t, "mypack")
+	os.WriteFile(local, archive, 0644)
+	idx := r.publish(t, registryEntry{Name: "mypack", Version: "1.0", URL: local, SHA256: sha(archive)})
+
+	e, _ := idx.find("mypack")
+	if _, err := downloadEntry(idx, e); err == nil {
+		t.Fatal("remote index entry with an absolute path was read from the local filesystem")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runWrapped implements `peon run [--project name] [--session id] -- <command>`.
+// It shows the command as a "working" pseudo-session in the action bar and tab
+// title, runs it with stdio passed through, and fires a complete or error
+// event when it exits. Returns the child's exit status.
+func runWrapped(peonDir string, args []string) int {
+	cwd, _ := os.Getwd()
+	project := filepath.Base(cwd)
+	sessionID := "run-" + strconv.Itoa(os.Getpid())
+
+flags:
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--":
+			args = args[1:]
+			break flags
+		case args[0] == "--project" && len(args) > 1:
+			project = args[1]
+			args = args[2:]
+		case args[0] == "--session" && len(args) > 1:
+			sessionID = args[1]
+			args = args[2:]
+		default:
+			// No "--": the rest is the command.
+			break flags
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: peon run [--project name] [--session id] -- <command> [args...]")
+		return 2
+	}
+	project = sanitizeProject(project)
+	cmdline := strings.Join(args, " ")
+
+	// Register the pseudo-session as working. This deliberately bypasses
+	// runEvent: a prompt_submit would count towards the annoyed check.
+	// Title escapes only go to a terminal, never into redirected output.
+	var tty io.Writer
+	if isTerminal(os.Stdout) {
+		tty = os.Stdout
+		fmt.Fprintf(tty, "\033]0;%s: working\007", project)
+	}
+	writeActionBarSession(peonDir, sessionID, project, "working", cmdline, 0)
+	defer removeActionBarSession(peonDir, sessionID)
+
+	last := &lastLineWriter{}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, last)
+	cmd.Stderr = io.MultiWriter(os.Stderr, last)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: %v\n", err)
+		finishWrapped(peonDir, sessionID, project, cmdline, 127, err.Error(), time.Since(start), tty)
+		return 127
+	}
+
+	// The child shares our process group, so a terminal's Ctrl-C or Ctrl-\
+	// already reaches it; forwarding those too would deliver them twice,
+	// which many tools take as a force-quit. They are caught only so peon
+	// outlives the child. Signals sent to peon alone are forwarded.
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigs {
+			if sig != syscall.SIGINT && sig != syscall.SIGQUIT {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	signal.Stop(sigs)
+	close(sigs)
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			code = 128 + int(ws.Signal())
+		}
+	} else if err != nil {
+		code = 1
+	}
+
+	finishWrapped(peonDir, sessionID, project, cmdline, code, last.Line(), time.Since(start), tty)
+	return code
+}
+
+// finishWrapped fires the completion event for a wrapped command. tty
+// receives the tab title; nil leaves it alone.
+func finishWrapped(peonDir, sessionID, project, cmdline string, code int, lastLine string, d time.Duration, tty io.Writer) {
+	msg := lastLine
+	if msg == "" {
+		msg = cmdline
+	}
+	notify := true
+	e := Event{
+		Type:      "task_complete",
+		SessionID: sessionID,
+		Project:   project,
+		Message:   msg,
+		Notify:    &notify,
+		Duration:  d,
+	}
+	if code != 0 {
+		e.Category = "error"
+		e.Urgency = "critical"
+		e.Message = fmt.Sprintf("exit %d: %s", code, msg)
+	}
+	runEvent(peonDir, e, "", hookOptions{TTY: tty})
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// lastLineWriter remembers the last non-empty line written to it.
+type lastLineWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	last    string
+}
+
+func (w *lastLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.partial[:i])); line != "" {
+			w.last = line
+		}
+		w.partial = w.partial[i+1:]
+	}
+	// Keep memory bounded for output without newlines (progress bars).
+	if len(w.partial) > 4096 {
+		w.partial = w.partial[len(w.partial)-4096:]
+	}
+	return len(p), nil
+}
+
+// Line returns the last complete line, or a trailing partial line if the
+// output didn't end with a newline.
+func (w *lastLineWriter) Line() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	line := w.last
+	if tail := strings.TrimSpace(string(w.partial)); tail != "" {
+		line = tail
+	}
+	// Progress output often uses \r to redraw; keep the final frame.
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = strings.TrimSpace(line[i+1:])
+	}
+	if r := []rune(line); len(r) > 200 {
+		line = string(r[:197]) + "..."
+	}
+	return line
+}
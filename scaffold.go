@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// categoryAliases maps filename words to categories, on top of the category
+// names themselves.
+var categoryAliases = map[string]string{
+	"hello":   "greeting",
+	"ready":   "greeting",
+	"start":   "greeting",
+	"ack":     "acknowledge",
+	"ok":      "acknowledge",
+	"yes":     "acknowledge",
+	"done":    "complete",
+	"finish":  "complete",
+	"fail":    "error",
+	"failed":  "error",
+	"perm":    "permission",
+	"ask":     "permission",
+	"limit":   "resource_limit",
+	"angry":   "annoyed",
+	"annoy":   "annoyed",
+	"spam":    "annoyed",
+	"warcry":  "annoyed",
+	"welcome": "greeting",
+}
+
+// audioExts are the inputs pack new accepts. Anything but WAV needs ffmpeg.
+var audioExts = []string{".wav", ".mp3", ".ogg", ".flac", ".m4a", ".aac", ".opus"}
+
+// scaffoldSound is one input file and where it goes.
+type scaffoldSound struct {
+	src      string // input path
+	category string
+	file     string // name under sounds/
+	line     string
+}
+
+// newPackCmd implements `peon pack new <name> --from <dir> [--display-name
+// <text>] [--normalize] [--yes] [--force]`: build a pack from a directory of
+// audio files and install it.
+func newPackCmd(peonDir string, args []string) error {
+	var name, from, display string
+	var normalize, force bool
+	p := &prompter{in: bufio.NewReader(os.Stdin)}
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; a {
+		case "--from", "--display-name":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s needs a value", a)
+			}
+			i++
+			if a == "--from" {
+				from = args[i]
+			} else {
+				display = args[i]
+			}
+		case "--normalize":
+			normalize = true
+		case "--yes", "-y":
+			p.yes = true
+		case "--force", "-f":
+			force = true
+		default:
+			name = a
+		}
+	}
+	if name == "" || from == "" {
+		return errors.New("usage: peon pack new <name> --from <dir> [--display-name <text>] [--normalize] [--yes] [--force]")
+	}
+	if !packNameRe.MatchString(name) {
+		return fmt.Errorf("invalid pack name %q", name)
+	}
+	if display == "" {
+		display = name
+	}
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	if normalize && ffmpeg == "" {
+		return errors.New("--normalize needs ffmpeg on PATH")
+	}
+
+	sounds, err := scanSounds(from, p, ffmpeg != "")
+	if err != nil {
+		return err
+	}
+	if len(sounds) == 0 {
+		return fmt.Errorf("no usable audio files in %s", from)
+	}
+
+	// Build the pack in a temp dir, then install it like any other pack so
+	// it gets the same validation and atomic move.
+	tmp, err := os.MkdirTemp("", "peon-pack-new-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Mkdir(filepath.Join(tmp, "sounds"), 0755); err != nil {
+		return err
+	}
+	m := Manifest{Name: name, DisplayName: display, Categories: make(map[string]ManifestCategory)}
+	for _, s := range sounds {
+		dst := filepath.Join(tmp, "sounds", s.file)
+		if normalize || !strings.EqualFold(filepath.Ext(s.src), ".wav") {
+			err = convertToWAV(ffmpeg, s.src, dst)
+		} else {
+			err = copyFile(s.src, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.src, err)
+		}
+		c := m.Categories[s.category]
+		c.Sounds = append(c.Sounds, ManifestSound{File: s.file, Line: s.line})
+		m.Categories[s.category] = c
+	}
+	data, _ := json.MarshalIndent(m, "", "  ")
+	if err := os.WriteFile(filepath.Join(tmp, "manifest.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	if _, err := installPack(peonDir, tmp, name, force); err != nil {
+		return err
+	}
+	dir := filepath.Join(packsDir(peonDir), name)
+	fmt.Printf("peon-ping: created pack %s in %s\n", name, dir)
+	cats := make([]string, 0, len(m.Categories))
+	for c := range m.Categories {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for _, c := range cats {
+		fmt.Printf("  %-16s %d sound(s)\n", c, len(m.Categories[c].Sounds))
+	}
+
+	l := &packLinter{peonDir: peonDir, dir: dir, maxDuration: defaultMaxSoundDuration}
+	l.lint()
+	for _, i := range l.issues {
+		fmt.Println(i)
+	}
+	return nil
+}
+
+// scanSounds walks from and assigns each audio file a category, a name
+// under sounds/ and a line. Files that match no category are asked about,
+// or skipped with --yes.
+func scanSounds(from string, p *prompter, canConvert bool) ([]scaffoldSound, error) {
+	var paths []string
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && slices.Contains(audioExts, strings.ToLower(filepath.Ext(path))) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	known := knownCategories()
+	used := make(map[string]bool)
+	var sounds []scaffoldSound
+	for _, path := range paths {
+		if !canConvert && !strings.EqualFold(filepath.Ext(path), ".wav") {
+			fmt.Fprintf(os.Stderr, "peon-ping: skipping %s (install ffmpeg to convert it to WAV)\n", path)
+			continue
+		}
+		rel, _ := filepath.Rel(from, path)
+		cat := guessCategory(rel)
+		if cat == "" {
+			ans := p.ask(fmt.Sprintf("Category for %s (%s, or blank to skip)", rel, strings.Join(known, ", ")), "")
+			if !slices.Contains(known, ans) {
+				if ans != "" {
+					fmt.Fprintf(os.Stderr, "peon-ping: unknown category %q, skipping %s\n", ans, rel)
+				}
+				continue
+			}
+			cat = ans
+		}
+		sounds = append(sounds, scaffoldSound{
+			src:      path,
+			category: cat,
+			file:     uniqueSoundName(used, path),
+			line:     soundLine(path, cat),
+		})
+	}
+	return sounds, nil
+}
+
+// guessCategory finds a category from a file's relative path: a directory
+// named after one (greeting/hello.wav), or a leading word in the file name
+// (greeting_hello.wav, done-1.wav). Category names win over aliases.
+func guessCategory(rel string) string {
+	known := knownCategories()
+	match := func(word string) string {
+		word = strings.ToLower(word)
+		if slices.Contains(known, word) {
+			return word
+		}
+		return categoryAliases[word]
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if c := match(dir); c != "" {
+			return c
+		}
+	}
+	base := strings.TrimSuffix(parts[len(parts)-1], filepath.Ext(rel))
+	// resource_limit contains the separator, so try the full name first.
+	for _, c := range known {
+		if strings.HasPrefix(strings.ToLower(base), c) {
+			return c
+		}
+	}
+	words := splitWords(base)
+	if len(words) > 0 {
+		return match(words[0])
+	}
+	return ""
+}
+
+// soundLine returns the text a sound says: the contents of a sidecar .txt
+// file if there is one, or else the file name minus a category prefix.
+func soundLine(path, category string) string {
+	if data, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".txt"); err == nil {
+		if line := strings.TrimSpace(string(data)); line != "" {
+			return line
+		}
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if strings.HasPrefix(strings.ToLower(base), category) {
+		base = base[len(category):]
+	}
+	words := splitWords(base)
+	// Drop trailing numbers (hello_2).
+	for len(words) > 0 && strings.IndexFunc(words[len(words)-1], func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	line := strings.Join(words, " ")
+	r := []rune(line)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// splitWords splits a file name on _, - , . and spaces.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || unicode.IsSpace(r)
+	})
+}
+
+// uniqueSoundName picks a flat .wav name under sounds/ for path, adding a
+// number if another input already took it.
+func uniqueSoundName(used map[string]bool, path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name := base + ".wav"
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s-%d.wav", base, i)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// convertToWAV converts (or normalizes) an audio file to 16-bit 44.1 kHz
+// WAV with ffmpeg, keeping the channel count and evening out loudness.
+func convertToWAV(ffmpeg, src, dst string) error {
+	out, err := exec.Command(ffmpeg, "-nostdin", "-loglevel", "error", "-i", src,
+		"-af", "loudnorm", "-ar", "44100", "-sample_fmt", "s16", "-y", dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
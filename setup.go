@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// harness is an AI coding tool peon can hook into.
+type harness struct {
+	Name      string
+	ConfigDir string // presence means the tool is installed
+	Install   func(peonDir string) error
+	Uninstall func() error
+}
+
+// knownHarnesses returns the harnesses peon supports, with their config dirs
+// resolved against the user's home directory.
+func knownHarnesses() []harness {
+	home, _ := os.UserHomeDir()
+	return []harness{
+		{
+			Name:      "Claude Code",
+			ConfigDir: filepath.Join(home, ".claude"),
+			Install:   func(peonDir string) error { return installClaudeHooks(peonDir, "user") },
+			Uninstall: func() error { return uninstallClaudeHooks("user") },
+		},
+		{
+			Name:      "OpenCode",
+			ConfigDir: filepath.Join(home, ".config", "opencode"),
+			Install:   func(string) error { return installOpenCode() },
+			Uninstall: uninstallOpenCode,
+		},
+		{
+			Name:      "Codex",
+			ConfigDir: filepath.Join(home, ".codex"),
+			Install:   installCodex,
+			Uninstall: uninstallCodex,
+		},
+	}
+}
+
+// detectPlatform returns "wsl", "linux" or "macos".
+func detectPlatform() string {
+	if runtime.GOOS == "darwin" {
+		return "macos"
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return "wsl"
+	}
+	if data, err := os.ReadFile("/proc/version"); err == nil {
+		v := strings.ToLower(string(data))
+		if strings.Contains(v, "microsoft") || strings.Contains(v, "wsl") {
+			return "wsl"
+		}
+	}
+	return "linux"
+}
+
+// prompter asks yes/no and free-text questions on the terminal. With yes set
+// (peon setup --yes) every question takes its default.
+type prompter struct {
+	in  *bufio.Reader
+	yes bool
+}
+
+func (p *prompter) ask(question, def string) string {
+	if p.yes {
+		return def
+	}
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, _ := p.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	d := "Y/n"
+	if !def {
+		d = "y/N"
+	}
+	ans := strings.ToLower(p.ask(question+" ("+d+")", ""))
+	if ans == "" {
+		return def
+	}
+	return ans == "y" || ans == "yes"
+}
+
+// runSetup implements `peon setup [--yes]`: detect the platform and installed
+// harnesses, hook peon into each, pick a pack and fire a test event.
+func runSetup(peonDir string, args []string) {
+	p := &prompter{in: bufio.NewReader(os.Stdin)}
+	for _, a := range args {
+		if a == "--yes" || a == "-y" {
+			p.yes = true
+		}
+	}
+
+	platform := detectPlatform()
+	fmt.Printf("peon-ping setup (%s, peon dir %s)\n\n", platform, peonDir)
+	if err := os.MkdirAll(peonDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: could not create %s: %v\n", peonDir, err)
+		os.Exit(1)
+	}
+
+	// Harness hooks. Keep going past failures so one broken settings file
+	// doesn't stop the rest of setup; report them all at the end.
+	var failed []string
+	defer func() {
+		if len(failed) > 0 {
+			fmt.Fprintln(os.Stderr, "peon-ping: setup finished with errors:")
+			for _, f := range failed {
+				fmt.Fprintln(os.Stderr, "  "+f)
+			}
+			os.Exit(1)
+		}
+	}()
+	found := 0
+	for _, h := range knownHarnesses() {
+		if !fileExists(h.ConfigDir) {
+			fmt.Printf("  %-12s not found (%s)\n", h.Name, h.ConfigDir)
+			continue
+		}
+		found++
+		if p.confirm(fmt.Sprintf("Hook peon into %s?", h.Name), true) {
+			if err := h.Install(peonDir); err != nil {
+				failed = append(failed, h.Name+": "+err.Error())
+			}
+		}
+	}
+	if found == 0 {
+		fmt.Println("No supported harness found. Use 'peon emit' or 'peon run' from scripts.")
+	}
+
+	// Platform extras.
+	if platform == "wsl" {
+		if !fileExists(filepath.Join(binDir(peonDir), "peon-helper.exe")) {
+			fmt.Println("Warning: peon-helper.exe not found next to peon; WSL audio and popups need it (run 'make install').")
+		} else if p.confirm("Start the action bar when Windows starts?", false) {
+			if err := installStartupShortcut(peonDir); err != nil {
+				failed = append(failed, "startup script: "+err.Error())
+			}
+		}
+	}
+
+	// Pack selection.
+	cfg := loadUserConfig(peonDir)
+	packs, _ := listPacks(peonDir)
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	if len(packs) == 0 {
+		fmt.Printf("No sound packs found in %s; keeping %q.\n", packsDir(peonDir), cfg.ActivePack)
+	} else {
+		fmt.Println("\nSound packs:")
+		def := 1
+		for i, pk := range packs {
+			display := pk.DisplayName
+			if display == "" {
+				display = pk.Name
+			}
+			if pk.Name == cfg.ActivePack {
+				def = i + 1
+			}
+			fmt.Printf("  %d) %-24s %s\n", i+1, pk.Name, display)
+		}
+		for {
+			n, err := strconv.Atoi(p.ask("Pick a pack", strconv.Itoa(def)))
+			if err != nil || n < 1 || n > len(packs) {
+				fmt.Println("Please enter a number from the list.")
+				continue
+			}
+			name := packs[n-1].Name
+			if !p.yes {
+				if f := previewSound(peonDir, name); f != "" {
+					playSound(f, cfg.Volume)
+				}
+				if !p.confirm("Use "+name+"?", true) {
+					def = n
+					continue
+				}
+			}
+			cfg.ActivePack = name
+			break
+		}
+	}
+	if err := saveConfig(peonDir, cfg); err != nil {
+		failed = append(failed, "config: "+err.Error())
+	} else {
+		fmt.Printf("peon-ping: wrote %s\n", filepath.Join(peonDir, "config.json"))
+	}
+
+	// Test event.
+	notify := true
+	runEvent(peonDir, Event{
+		Type:    "task_complete",
+		Project: "peon-ping",
+		Message: "Setup complete",
+		Notify:  &notify,
+	}, "", hookOptions{})
+	fmt.Println("peon-ping: setup complete — you should hear a sound and see a notification")
+}
+
+// previewSound returns a greeting (or any) sound from a pack for previewing.
+func previewSound(peonDir, pack string) string {
+	m, err := loadManifest(peonDir, pack)
+	if err != nil {
+		return ""
+	}
+	cats := []string{"greeting"}
+	for c := range m.Categories {
+		cats = append(cats, c)
+	}
+	for _, c := range cats {
+		for _, s := range m.Categories[c].Sounds {
+			f := soundPath(peonDir, pack, s)
+			if fileExists(f) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// runUninstall implements `peon uninstall [--purge] [--yes]`: remove every
+// hook, plugin and startup entry peon added. --purge also deletes the peon
+// dir (config, packs and state).
+func runUninstall(peonDir string, args []string) {
+	p := &prompter{in: bufio.NewReader(os.Stdin)}
+	purge := false
+	for _, a := range args {
+		switch a {
+		case "--yes", "-y":
+			p.yes = true
+		case "--purge":
+			purge = true
+		}
+	}
+
+	// Keep going past failures so one broken settings file doesn't leave
+	// the rest installed; report them all at the end.
+	var failed []string
+	for _, h := range knownHarnesses() {
+		if err := h.Uninstall(); err != nil {
+			failed = append(failed, h.Name+": "+err.Error())
+		}
+	}
+	if detectPlatform() == "wsl" && startupVBSPath() != "" {
+		if err := uninstallStartupShortcut(); err != nil {
+			failed = append(failed, "startup script: "+err.Error())
+		}
+	}
+	defer func() {
+		if len(failed) > 0 {
+			fmt.Fprintln(os.Stderr, "peon-ping: uninstall finished with errors:")
+			for _, f := range failed {
+				fmt.Fprintln(os.Stderr, "  "+f)
+			}
+			os.Exit(1)
+		}
+	}()
+
+	if purge {
+		d := dirsFor(peonDir)
+		var dirs []string
+		for _, dir := range []string{d.Config, d.Data, d.State, d.Runtime} {
+			if !slices.Contains(dirs, dir) && fileExists(dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+		if len(dirs) == 0 {
+			return
+		}
+		if !p.yes && !p.confirm(fmt.Sprintf("Delete %s (config, packs, state)?", strings.Join(dirs, ", ")), false) {
+			return
+		}
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				failed = append(failed, fmt.Sprintf("could not remove %s: %v", dir, err))
+				continue
+			}
+			fmt.Printf("peon-ping: removed %s\n", dir)
+		}
+	}
+}
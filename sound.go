@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 // Manifest represents a sound pack's manifest.json.
@@ -12,63 +15,260 @@ type Manifest struct {
 	Name        string                      `json:"name"`
 	DisplayName string                      `json:"display_name"`
 	Categories  map[string]ManifestCategory `json:"categories"`
+	// Extends names a pack to inherit categories from. A category listed
+	// here replaces the inherited one; an empty or disabled one removes it.
+	Extends string `json:"extends,omitempty"`
+
+	dir     string         // pack directory, set by listPacks
+	overlay string         // packs.d dir applied, set by loadManifest
+	removed []removedEntry // what the overlay took out
 }
 
 // ManifestCategory holds the sounds for one category.
 type ManifestCategory struct {
 	Sounds []ManifestSound `json:"sounds"`
+	// Disabled and Replace are for packs.d overlays: drop the category, or
+	// use the overlay's sounds instead of merging them in.
+	Disabled bool `json:"disabled,omitempty"`
+	Replace  bool `json:"replace,omitempty"`
 }
 
 // ManifestSound is a single sound entry.
 type ManifestSound struct {
 	File string `json:"file"`
 	Line string `json:"line"`
+	// Weight is the relative chance of picking this sound (default 1).
+	Weight *float64 `json:"weight,omitempty"`
+	// Volume multiplies the configured volume for this sound (default 1).
+	Volume *float64 `json:"volume,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	// MinInterval is how many seconds must pass before the sound plays again.
+	MinInterval float64 `json:"min_interval,omitempty"`
+	// Disabled removes the sound; used by packs.d overlays.
+	Disabled bool `json:"disabled,omitempty"`
+
+	dir    string // sounds directory holding File, set by loadManifest
+	source string // pack or overlay the entry came from, e.g. "packs.d/peon"
+}
+
+func (s ManifestSound) weight() float64 {
+	if s.Weight == nil {
+		return 1
+	}
+	return *s.Weight
 }
 
-// loadManifest loads a sound pack's manifest.json.
+func (s ManifestSound) volume() float64 {
+	if s.Volume == nil {
+		return 1
+	}
+	return *s.Volume
+}
+
+// playedKey identifies a sound in State.PlayedAt and State.LastPlayed. The
+// file name alone is not enough: inherited and overlay sounds can share it.
+func (s ManifestSound) playedKey() string {
+	return s.source + "/" + s.File
+}
+
+// maxExtendsDepth bounds manifest inheritance chains.
+const maxExtendsDepth = 8
+
+// loadManifest loads a sound pack's manifest.json, with the categories of
+// any packs it extends merged in and its packs.d overlay applied.
 func loadManifest(peonDir, packName string) (Manifest, error) {
-	path := filepath.Join(peonDir, "packs", packName, "manifest.json")
-	data, err := os.ReadFile(path)
+	return loadManifestChain(peonDir, packName, nil)
+}
+
+func loadManifestChain(peonDir, packName string, chain []string) (Manifest, error) {
+	if slices.Contains(chain, packName) || len(chain) >= maxExtendsDepth {
+		return Manifest{}, fmt.Errorf("extends loop: %s → %s", strings.Join(chain, " → "), packName)
+	}
+	path := filepath.Join(packsDir(peonDir), packName, "manifest.json")
+	m, err := cachedLoad(path, func(data []byte) (Manifest, error) {
+		var m Manifest
+		err := json.Unmarshal(data, &m)
+		return m, err
+	})
 	if err != nil {
 		return Manifest{}, err
 	}
-	var m Manifest
-	if err := json.Unmarshal(data, &m); err != nil {
-		return Manifest{}, err
+
+	// Copy the categories: the cached manifest is shared.
+	soundsDir := filepath.Join(packsDir(peonDir), packName, "sounds")
+	cats := make(map[string]ManifestCategory, len(m.Categories))
+	var disabled []string
+	for name, c := range m.Categories {
+		if c.Disabled {
+			disabled = append(disabled, name)
+			continue
+		}
+		sounds := make([]ManifestSound, 0, len(c.Sounds))
+		for _, s := range c.Sounds {
+			if !s.Disabled {
+				s.dir, s.source = soundsDir, packName
+				sounds = append(sounds, s)
+			}
+		}
+		cats[name] = ManifestCategory{Sounds: sounds}
+	}
+	if m.Extends != "" {
+		parent, err := loadManifestChain(peonDir, m.Extends, append(chain, packName))
+		if err != nil {
+			return Manifest{}, fmt.Errorf("%s extends %s: %w", packName, m.Extends, err)
+		}
+		for name, c := range parent.Categories {
+			if _, ok := cats[name]; !ok && !slices.Contains(disabled, name) {
+				cats[name] = c
+			}
+		}
+	}
+	m.Categories = cats
+	if err := applyOverlay(peonDir, packName, &m); err != nil {
+		// A broken overlay must not silence the pack; lint reports it.
+		logError("overlay", err)
 	}
 	return m, nil
 }
 
-// pickSound selects a random sound from the category, avoiding the last-played.
-// Updates state.LastPlayed. Returns the full path to the sound file, or "" if none.
-func pickSound(peonDir, packName, category string, state *State) string {
+// soundPath returns the file for a manifest sound. Inherited and overlay
+// sounds live where they were defined.
+func soundPath(peonDir, packName string, s ManifestSound) string {
+	if s.dir != "" {
+		return filepath.Join(s.dir, s.File)
+	}
+	return filepath.Join(packsDir(peonDir), packName, "sounds", s.File)
+}
+
+// tagFilter restricts which sounds may play by their tags. Exclude is
+// strict; Include is a preference that is dropped when nothing matches.
+type tagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// tagFilterFor builds the filter from config and the safe mode switch.
+func tagFilterFor(cfg Config, safeMode bool) tagFilter {
+	f := tagFilter{Include: cfg.IncludeTags, Exclude: slices.Clone(cfg.ExcludeTags)}
+	if safeMode {
+		f.Exclude = append(f.Exclude, cfg.safeModeTags()...)
+	}
+	return f
+}
+
+func (f tagFilter) empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// apply filters sounds by tag. Excluded sounds never pass. If no sound has
+// an included tag, every non-excluded sound does, so an include list never
+// silences a category on its own.
+func (f tagFilter) apply(sounds []ManifestSound) []ManifestSound {
+	hasAny := func(s ManifestSound, tags []string) bool {
+		return slices.ContainsFunc(s.Tags, func(t string) bool { return slices.Contains(tags, t) })
+	}
+	var allowed, preferred []ManifestSound
+	for _, s := range sounds {
+		if hasAny(s, f.Exclude) {
+			continue
+		}
+		allowed = append(allowed, s)
+		if hasAny(s, f.Include) {
+			preferred = append(preferred, s)
+		}
+	}
+	if len(preferred) > 0 {
+		return preferred
+	}
+	return allowed
+}
+
+// pickSound selects a sound from the category by weight, avoiding the
+// last-played one and any still within its min_interval or ruled out by
+// tags. Updates state.LastPlayed and state.PlayedAt. Returns the full path
+// to the sound file and its volume multiplier, or "" if none.
+func pickSound(peonDir, packName, category string, state *State, now float64, tags tagFilter) (string, float64) {
 	manifest, err := loadManifest(peonDir, packName)
 	if err != nil {
-		return ""
+		return "", 0
 	}
 
 	cat, ok := manifest.Categories[category]
 	if !ok || len(cat.Sounds) == 0 {
-		return ""
+		return "", 0
+	}
+
+	// Sounds that are cooling down or weighted out are never candidates.
+	ready := make([]ManifestSound, 0, len(cat.Sounds))
+	for _, s := range cat.Sounds {
+		if s.weight() <= 0 {
+			continue
+		}
+		if s.MinInterval > 0 && now-state.PlayedAt[s.playedKey()] < s.MinInterval {
+			continue
+		}
+		ready = append(ready, s)
+	}
+	ready = tags.apply(ready)
+	if len(ready) == 0 {
+		return "", 0
 	}
 
-	lastFile := state.LastPlayed[category]
+	last := state.LastPlayed[category]
 
-	candidates := cat.Sounds
-	if len(cat.Sounds) > 1 {
-		filtered := make([]ManifestSound, 0, len(cat.Sounds))
-		for _, s := range cat.Sounds {
-			if s.File != lastFile {
+	candidates := ready
+	if len(ready) > 1 {
+		filtered := make([]ManifestSound, 0, len(ready))
+		for _, s := range ready {
+			if s.playedKey() != last {
 				filtered = append(filtered, s)
 			}
 		}
-		candidates = filtered
+		if len(filtered) > 0 {
+			candidates = filtered
+		}
+	}
+
+	pick := weightedPick(candidates)
+	state.LastPlayed[category] = pick.playedKey()
+	if pick.MinInterval > 0 {
+		if state.PlayedAt == nil {
+			state.PlayedAt = make(map[string]float64)
+		}
+		state.PlayedAt[pick.playedKey()] = now
+		for k, t := range state.PlayedAt {
+			if now-t > 7*86400 {
+				delete(state.PlayedAt, k)
+			}
+		}
 	}
 
-	pick := candidates[rand.Intn(len(candidates))]
-	state.LastPlayed[category] = pick.File
+	return soundPath(peonDir, packName, pick), pick.volume()
+}
+
+// weightedPick chooses a sound with probability proportional to its weight.
+// All candidates have positive weight.
+func weightedPick(sounds []ManifestSound) ManifestSound {
+	total := 0.0
+	for _, s := range sounds {
+		total += s.weight()
+	}
+	r := rand.Float64() * total
+	for _, s := range sounds {
+		if r -= s.weight(); r < 0 {
+			return s
+		}
+	}
+	return sounds[len(sounds)-1]
+}
 
-	return filepath.Join(peonDir, "packs", packName, "sounds", pick.File)
+// resolveSound maps an explicitly requested sound to a path. Absolute paths are
+// used as-is; relative names are looked up in the active pack's sounds/ dir.
+func resolveSound(peonDir, packName, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(packsDir(peonDir), packName, "sounds", filepath.Clean("/"+file))
 }
 
 // checkAnnoyed checks if the user is spamming prompts.
@@ -117,7 +317,7 @@ func checkAgent(state *State, sessionID, permissionMode string) bool {
 
 // listPacks returns all available pack directories with manifests.
 func listPacks(peonDir string) ([]Manifest, error) {
-	pattern := filepath.Join(peonDir, "packs", "*", "manifest.json")
+	pattern := filepath.Join(packsDir(peonDir), "*", "manifest.json")
 	matches, err := filepath.Glob(pattern)
 	if err != nil {
 		return nil, err
@@ -125,6 +325,9 @@ func listPacks(peonDir string) ([]Manifest, error) {
 
 	var packs []Manifest
 	for _, m := range matches {
+		if strings.HasPrefix(filepath.Base(filepath.Dir(m)), ".") {
+			continue // install staging
+		}
 		data, err := os.ReadFile(m)
 		if err != nil {
 			continue
@@ -137,6 +340,7 @@ func listPacks(peonDir string) ([]Manifest, error) {
 		if manifest.Name == "" {
 			manifest.Name = filepath.Base(filepath.Dir(m))
 		}
+		manifest.dir = filepath.Dir(m)
 		packs = append(packs, manifest)
 	}
 	return packs, nil
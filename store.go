@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store holds peon's runtime data (sound state, action bar sessions, the
+// pause flag and update check results) in one file under one lock, so an
+// event is a single read-modify-write.
+//
+// .actionbar.json is still written on every commit that changes the action
+// bar, as a read-only view for the helper. The permission mailbox (response
+// and heartbeat files) stays file-based because the helper, running on the
+// Windows side, writes and stats those files directly.
+type Store interface {
+	// Begin locks the store and loads its data. The caller must Commit or
+	// Rollback the returned transaction.
+	Begin() (*StoreTx, error)
+	// Update runs fn in a transaction, committing unless fn returns an error.
+	Update(fn func(d *StoreData) error) error
+	// Snapshot reads the data without locking, for read-only callers.
+	Snapshot() *StoreData
+
+	// Heartbeat tells the helper a permission hook is alive and polling.
+	Heartbeat(sessionID string)
+	// EndHeartbeat removes the heartbeat, so the helper stops treating the
+	// request as pending.
+	EndHeartbeat(sessionID string)
+	// PermissionResponse returns the helper's answer for a session, if any.
+	PermissionResponse(sessionID string) (permissionRspFile, bool)
+	// ClearPermissionResponse discards a (possibly stale) answer.
+	ClearPermissionResponse(sessionID string)
+}
+
+// StoreData is everything in the store.
+type StoreData struct {
+	Version         int            `json:"version"`
+	State           State          `json:"state"`
+	ActionBar       ActionBarState `json:"actionbar"`
+	Paused          bool           `json:"paused,omitempty"`
+	SafeMode        bool           `json:"safe_mode,omitempty"`
+	LastUpdateCheck int64          `json:"last_update_check,omitempty"` // unix seconds
+	UpdateAvailable string         `json:"update_available,omitempty"`  // newer version, if any
+}
+
+// storeMigrations[i] upgrades .store.json from version i to i+1.
+var storeMigrations = []migration{
+	// 0 → 1: initial layout.
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+var storeVersion = len(storeMigrations)
+
+// fileStore is the Store kept in <dir>/.store.json, locked in lockDir.
+type fileStore struct {
+	dir     string // state dir
+	lockDir string // runtime dir
+}
+
+// openStore returns the store for a peon dir.
+func openStore(peonDir string) Store {
+	return &fileStore{dir: stateDir(peonDir), lockDir: runtimeDir(peonDir)}
+}
+
+func (s *fileStore) path() string { return filepath.Join(s.dir, ".store.json") }
+
+// StoreTx is an open transaction. Data may be modified freely until Commit.
+type StoreTx struct {
+	Data *StoreData
+
+	store    *fileStore
+	lock     *fileLock
+	abBefore []byte // action bar as loaded, to skip unchanged exports
+	legacy   bool   // data was imported from pre-store files
+	done     bool
+}
+
+func (s *fileStore) Begin() (*StoreTx, error) {
+	lock, err := acquireLock(filepath.Join(s.lockDir, ".store.lock"), lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	tx := &StoreTx{store: s, lock: lock}
+	data, err := os.ReadFile(s.path())
+	switch {
+	case os.IsNotExist(err):
+		tx.Data = s.loadLegacy()
+		tx.legacy = true
+	default:
+		if tx.Data, err = decodeStore(data); err != nil {
+			quarantineFile(s.path(), data, err)
+			tx.Data = decodeStoreOrEmpty(nil)
+		}
+	}
+	tx.abBefore, _ = json.Marshal(tx.Data.ActionBar)
+	return tx, nil
+}
+
+// Commit writes the data atomically, refreshes the helper's action bar view
+// if it changed, and releases the lock.
+func (tx *StoreTx) Commit() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	defer tx.lock.Unlock()
+
+	d := tx.Data
+	d.Version = storeVersion
+	d.State.Version = stateVersion
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := atomicWriteFile(tx.store.path(), data); err != nil {
+		return err
+	}
+	if ab, _ := json.Marshal(d.ActionBar); tx.legacy || !bytes.Equal(ab, tx.abBefore) {
+		if err := atomicWriteFile(filepath.Join(tx.store.dir, ".actionbar.json"), ab); err != nil {
+			return err
+		}
+	}
+	if tx.legacy {
+		tx.store.removeLegacy()
+	}
+	return nil
+}
+
+// Rollback releases the lock without writing. Safe to call after Commit.
+func (tx *StoreTx) Rollback() {
+	if tx.done || tx.lock == nil {
+		return
+	}
+	tx.done = true
+	tx.lock.Unlock()
+}
+
+func (s *fileStore) Update(fn func(d *StoreData) error) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx.Data); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *fileStore) Snapshot() *StoreData {
+	data, err := os.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return s.loadLegacy()
+	}
+	return decodeStoreOrEmpty(data)
+}
+
+// decodeStore parses .store.json, migrating older versions. An error means
+// the file is corrupt.
+func decodeStore(data []byte) (*StoreData, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if err := migrate(m, storeMigrations); err != nil {
+		return nil, err
+	}
+	migrated, _ := json.Marshal(m)
+	var d StoreData
+	if err := json.Unmarshal(migrated, &d); err != nil {
+		return nil, err
+	}
+	initStoreData(&d)
+	return &d, nil
+}
+
+func decodeStoreOrEmpty(data []byte) *StoreData {
+	if d, err := decodeStore(data); err == nil {
+		return d
+	}
+	var d StoreData
+	initStoreData(&d)
+	return &d
+}
+
+func initStoreData(d *StoreData) {
+	if d.State.LastPlayed == nil {
+		d.State.LastPlayed = make(map[string]string)
+	}
+	if d.ActionBar.Sessions == nil {
+		d.ActionBar.Sessions = make(map[string]ActionBarSession)
+	}
+}
+
+// legacyStoreFiles were used before the store; their contents are imported
+// the first time the store is opened, then they are removed.
+// .actionbar.json is not listed: it lives on as the helper's view.
+var legacyStoreFiles = []string{".state.json", ".paused", ".last_update_check", ".update_available"}
+
+// loadLegacy builds store data from the pre-store files, if any.
+func (s *fileStore) loadLegacy() *StoreData {
+	var d StoreData
+	statePath := filepath.Join(s.dir, ".state.json")
+	if data, err := os.ReadFile(statePath); err == nil {
+		if st, err := decodeState(data); err == nil {
+			d.State = *st
+		} else {
+			quarantineFile(statePath, data, err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(s.dir, ".actionbar.json")); err == nil {
+		json.Unmarshal(data, &d.ActionBar)
+	}
+	d.Paused = fileExists(filepath.Join(s.dir, ".paused"))
+	if data, err := os.ReadFile(filepath.Join(s.dir, ".last_update_check")); err == nil {
+		d.LastUpdateCheck, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	if data, err := os.ReadFile(filepath.Join(s.dir, ".update_available")); err == nil {
+		d.UpdateAvailable = strings.TrimSpace(string(data))
+	}
+	initStoreData(&d)
+	return &d
+}
+
+func (s *fileStore) removeLegacy() {
+	for _, name := range legacyStoreFiles {
+		os.Remove(filepath.Join(s.dir, name))
+	}
+	os.Remove(filepath.Join(s.dir, ".actionbar.lock"))
+	os.Remove(filepath.Join(s.dir, ".state.lock"))
+}
+
+// The permission mailbox lives next to .actionbar.json, which is where the
+// helper looks for it.
+
+func (s *fileStore) heartbeatPath(sid string) string {
+	return filepath.Join(s.dir, ".actionbar-hb-"+sid)
+}
+
+func (s *fileStore) responsePath(sid string) string {
+	return filepath.Join(s.dir, ".actionbar-rsp-"+sid+".json")
+}
+
+func (s *fileStore) Heartbeat(sid string) {
+	p := s.heartbeatPath(sid)
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		os.WriteFile(p, nil, 0644)
+	}
+}
+
+func (s *fileStore) EndHeartbeat(sid string) {
+	os.Remove(s.heartbeatPath(sid))
+}
+
+func (s *fileStore) PermissionResponse(sid string) (permissionRspFile, bool) {
+	var rsp permissionRspFile
+	data, err := os.ReadFile(s.responsePath(sid))
+	if err != nil || json.Unmarshal(data, &rsp) != nil {
+		return rsp, false // not (fully) written yet
+	}
+	return rsp, true
+}
+
+func (s *fileStore) ClearPermissionResponse(sid string) {
+	os.Remove(s.responsePath(sid))
+}
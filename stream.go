@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// runStream reads newline-delimited hook payloads from r until EOF and runs
+// each through handleHook. Long-lived bridges (like the OpenCode plugin) use
+// this instead of spawning a process per event; config and manifests stay
+// cached between events via cachedLoad.
+//
+// With results set, one JSON hookResult line is written to w per event. An
+// "id" field on the input line is echoed back so callers can match results,
+// since permission requests block and are answered out of order.
+func runStream(peonDir string, r io.Reader, w io.Writer, results bool) {
+	var (
+		outMu sync.Mutex
+		wg    sync.WaitGroup
+	)
+	emit := func(res hookResult) {
+		if !results {
+			return
+		}
+		data, err := json.Marshal(res)
+		if err != nil {
+			return
+		}
+		outMu.Lock()
+		defer outMu.Unlock()
+		fmt.Fprintln(w, string(data))
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		input := append([]byte(nil), line...)
+
+		var probe struct {
+			ID            json.RawMessage `json:"id"`
+			Type          string          `json:"type"`
+			HookEventName string          `json:"hook_event_name"`
+		}
+		json.Unmarshal(input, &probe)
+
+		// Tab titles can't be written to stdout here: it carries results.
+		handle := func() {
+			res := handleHook(peonDir, input, hookOptions{})
+			recordHook(peonDir, input, res)
+			res.ID = probe.ID
+			emit(res)
+		}
+
+		// Permission requests block for up to minutes; don't hold up the
+		// rest of the stream behind them.
+		if probe.Type == "permission_request" || probe.HookEventName == "PermissionRequest" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handle()
+			}()
+			continue
+		}
+		handle()
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "peon-ping: stream: %v\n", err)
+	}
+	wg.Wait()
+}
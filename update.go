@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -14,24 +13,16 @@ import (
 const updateRepo = "cederikdotcom/peon-ping-go"
 
 // checkForUpdate checks GitHub for a newer version (once per day, non-blocking).
-// Should be called only on session_start events.
-func checkForUpdate(peonDir string) {
-	go func() {
-		checkFile := filepath.Join(peonDir, ".last_update_check")
-		now := time.Now().Unix()
-
-		// Read last check time.
-		if data, err := os.ReadFile(checkFile); err == nil {
-			if last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
-				if now-last < 86400 {
-					return
-				}
-			}
-		}
-
-		// Write current timestamp.
-		os.WriteFile(checkFile, []byte(strconv.FormatInt(now, 10)), 0644)
+// Should be called only on session_start events, with the event's open store
+// transaction; the result is saved in a later transaction of its own.
+func checkForUpdate(peonDir string, d *StoreData) {
+	now := time.Now().Unix()
+	if now-d.LastUpdateCheck < 86400 {
+		return
+	}
+	d.LastUpdateCheck = now
 
+	go func() {
 		localVersion := ""
 		if data, err := os.ReadFile(filepath.Join(peonDir, "VERSION")); err == nil {
 			localVersion = strings.TrimSpace(string(data))
@@ -50,23 +41,20 @@ func checkForUpdate(peonDir string) {
 		}
 		remoteVersion := strings.TrimSpace(string(body))
 
-		updateFile := filepath.Join(peonDir, ".update_available")
+		available := ""
 		if remoteVersion != "" && localVersion != "" && remoteVersion != localVersion {
-			os.WriteFile(updateFile, []byte(remoteVersion), 0644)
-		} else {
-			os.Remove(updateFile)
+			available = remoteVersion
 		}
+		logError("update check", openStore(peonDir).Update(func(d *StoreData) error {
+			d.UpdateAvailable = available
+			return nil
+		}))
 	}()
 }
 
 // showUpdateNotice prints an update notice if one is pending.
-func showUpdateNotice(peonDir string) {
-	updateFile := filepath.Join(peonDir, ".update_available")
-	data, err := os.ReadFile(updateFile)
-	if err != nil {
-		return
-	}
-	newVer := strings.TrimSpace(string(data))
+func showUpdateNotice(peonDir string, d *StoreData) {
+	newVer := d.UpdateAvailable
 	if newVer == "" {
 		return
 	}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// wavInfo is the format information from a WAV file's header.
+type wavInfo struct {
+	Format        uint16 // 1 = PCM, 3 = IEEE float
+	Channels      uint16
+	SampleRate    uint32
+	BitsPerSample uint16
+	DataSize      uint32
+}
+
+// Duration returns the playback length implied by the data chunk size.
+func (w wavInfo) Duration() time.Duration {
+	bytesPerSec := uint64(w.SampleRate) * uint64(w.Channels) * uint64(w.BitsPerSample) / 8
+	if bytesPerSec == 0 {
+		return 0
+	}
+	return time.Duration(uint64(w.DataSize) * uint64(time.Second) / bytesPerSec)
+}
+
+// readWAVInfo parses the RIFF header of a WAV file: the "fmt " chunk for the
+// format and the "data" chunk for its size. Other chunks are skipped.
+func readWAVInfo(path string) (wavInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return wavInfo{}, err
+	}
+	defer f.Close()
+
+	var hdr [12]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return wavInfo{}, errors.New("not a WAV file: too short")
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return wavInfo{}, errors.New("not a WAV file: missing RIFF/WAVE header")
+	}
+
+	var info wavInfo
+	haveFmt := false
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(f, ch[:]); err != nil {
+			break
+		}
+		id := string(ch[0:4])
+		size := binary.LittleEndian.Uint32(ch[4:8])
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return wavInfo{}, fmt.Errorf("fmt chunk too small (%d bytes)", size)
+			}
+			var b [16]byte
+			if _, err := io.ReadFull(f, b[:]); err != nil {
+				return wavInfo{}, errors.New("truncated fmt chunk")
+			}
+			info.Format = binary.LittleEndian.Uint16(b[0:2])
+			info.Channels = binary.LittleEndian.Uint16(b[2:4])
+			info.SampleRate = binary.LittleEndian.Uint32(b[4:8])
+			info.BitsPerSample = binary.LittleEndian.Uint16(b[14:16])
+			haveFmt = true
+			size -= 16
+		case "data":
+			if !haveFmt {
+				return wavInfo{}, errors.New("data chunk before fmt chunk")
+			}
+			info.DataSize = size
+			if info.Channels == 0 || info.SampleRate == 0 {
+				return wavInfo{}, errors.New("invalid fmt chunk (zero channels or sample rate)")
+			}
+			return info, nil
+		}
+		// Chunks are padded to an even size.
+		// Widen first: a hostile size of 0xFFFFFFFF would wrap in uint32.
+		if _, err := f.Seek(int64(size)+int64(size%2), io.SeekCurrent); err != nil {
+			break
+		}
+	}
+	if !haveFmt {
+		return wavInfo{}, errors.New("missing fmt chunk")
+	}
+	return wavInfo{}, errors.New("missing data chunk")
+}